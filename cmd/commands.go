@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coneno/logger"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/db"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/entrycodes"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/sampler"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/types"
+)
+
+const (
+	CMD_GENERATE_CODES = "generate-codes"
+	CMD_HASH_CODES     = "hash-entry-codes"
+	CMD_SAMPLER_REPORT = "sampler-report"
+	CMD_SIMULATE       = "simulate"
+)
+
+func runCommand(name string, args []string) {
+	switch name {
+	case CMD_GENERATE_CODES:
+		generateCodesCmd(args)
+	case CMD_HASH_CODES:
+		hashEntryCodesCmd(args)
+	case CMD_SAMPLER_REPORT:
+		samplerReportCmd(args)
+	case CMD_SIMULATE:
+		simulateCmd(args)
+	default:
+		logger.Error.Fatalf("unknown command: %s (available: %s)", name, strings.Join([]string{CMD_GENERATE_CODES, CMD_HASH_CODES, CMD_SAMPLER_REPORT, CMD_SIMULATE}, ", "))
+	}
+}
+
+// generateCodesCmd prints new entry codes to stdout, and saves them to the DB of INSTANCE_ID if requested
+func generateCodesCmd(args []string) {
+	fs := flag.NewFlagSet(CMD_GENERATE_CODES, flag.ExitOnError)
+	count := fs.Int("n", 100, "number of codes to generate")
+	save := fs.Bool("save", false, "save generated codes to the entry code collection of INSTANCE_ID")
+	group := fs.Bool("group", true, "insert separators as defined by ENTRY_CODE_GROUP_SIZE")
+	batchID := fs.String("batch", "", "batch ID stored with saved codes")
+	label := fs.String("label", "", "label or lot number stored with saved codes")
+	expiresAt := fs.Int64("expires-at", 0, "expiry of saved codes as unix timestamp (0: no expiry)")
+	if err := fs.Parse(args); err != nil {
+		logger.Error.Fatal(err)
+	}
+	if *count < 1 {
+		logger.Error.Fatal("number of codes must be positive")
+	}
+
+	format := getEntryCodeFormat()
+
+	var codes []string
+	var err error
+	if *save {
+		instanceID := os.Getenv(ENV_INSTANCE_ID)
+		if instanceID == "" {
+			logger.Error.Fatal(ENV_INSTANCE_ID + " must be set to save codes")
+		}
+		dbService := db.NewSelfSwabbingExtDBService(getDBConfig(), entrycodes.NewHasher(os.Getenv(ENV_ENTRY_CODE_HMAC_SECRET)))
+		if err := dbService.CreateIndexForEntryCodes(instanceID); err != nil {
+			logger.Error.Printf("unexpected error when creating index: %v", err)
+		}
+		batchInfo := types.CodeBatchInfo{
+			BatchID:   *batchID,
+			Label:     *label,
+			ExpiresAt: *expiresAt,
+		}
+		codes, err = format.GenerateAndSave(*count, func(codes []string) (map[string]bool, error) {
+			entryCodes := make([]types.ValidationCode, len(codes))
+			for i, code := range codes {
+				entryCodes[i] = types.ValidationCode{Code: code, CodeBatchInfo: batchInfo}
+			}
+			return dbService.AddEntryCodes(instanceID, entryCodes)
+		})
+	} else {
+		codes, err = format.Generate(*count)
+	}
+
+	for _, code := range codes {
+		if *group {
+			code = format.Group(code)
+		}
+		fmt.Println(code)
+	}
+	if err != nil {
+		logger.Error.Fatalf("%d / %d codes generated: %v", len(codes), *count, err)
+	}
+}
+
+// hashEntryCodesCmd converts all plain text entry codes of INSTANCE_ID to their keyed hash, can safely be run repeatedly
+func hashEntryCodesCmd(args []string) {
+	fs := flag.NewFlagSet(CMD_HASH_CODES, flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		logger.Error.Fatal(err)
+	}
+
+	instanceID := os.Getenv(ENV_INSTANCE_ID)
+	if instanceID == "" {
+		logger.Error.Fatal(ENV_INSTANCE_ID + " must be set")
+	}
+	secret := os.Getenv(ENV_ENTRY_CODE_HMAC_SECRET)
+	if secret == "" {
+		logger.Error.Fatal(ENV_ENTRY_CODE_HMAC_SECRET + " must be set")
+	}
+
+	dbService := db.NewSelfSwabbingExtDBService(getDBConfig(), entrycodes.NewHasher(secret))
+	count, err := dbService.HashPlaintextEntryCodes(instanceID)
+	if err != nil {
+		logger.Error.Fatalf("migration stopped after %d codes: %v", count, err)
+	}
+	logger.Info.Printf("%d entry codes converted to hashed form", count)
+}
+
+// samplerReportCmd prints how each sampling interval of INSTANCE_ID went, as CSV or JSON
+func samplerReportCmd(args []string) {
+	fs := flag.NewFlagSet(CMD_SAMPLER_REPORT, flag.ExitOnError)
+	from := fs.String("from", "", "only intervals starting on or after this date (YYYY-MM-DD)")
+	until := fs.String("until", "", "only intervals starting before this date (YYYY-MM-DD)")
+	format := fs.String("format", "csv", "output format: csv or json")
+	if err := fs.Parse(args); err != nil {
+		logger.Error.Fatal(err)
+	}
+	if *format != "csv" && *format != "json" {
+		logger.Error.Fatalf("unknown format: %s", *format)
+	}
+
+	instanceID := os.Getenv(ENV_INSTANCE_ID)
+	if instanceID == "" {
+		logger.Error.Fatal(ENV_INSTANCE_ID + " must be set")
+	}
+	interval := getSamplingIntervalConfig()
+
+	var fromTs, untilTs int64
+	if *from != "" {
+		t, err := time.ParseInLocation("2006-01-02", *from, interval.Location)
+		if err != nil {
+			logger.Error.Fatal("from: " + err.Error())
+		}
+		fromTs = t.Unix()
+	}
+	if *until != "" {
+		t, err := time.ParseInLocation("2006-01-02", *until, interval.Location)
+		if err != nil {
+			logger.Error.Fatal("until: " + err.Error())
+		}
+		untilTs = t.Unix() - 1
+	}
+
+	dbService := db.NewSelfSwabbingExtDBService(getDBConfig(), entrycodes.NewHasher(os.Getenv(ENV_ENTRY_CODE_HMAC_SECRET)))
+	reports, err := dbService.GetSamplerReport(instanceID, interval, fromTs, untilTs)
+	if err != nil {
+		logger.Error.Fatalf("could not create sampler report: %v", err)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			logger.Error.Fatal(err)
+		}
+		return
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	if err := w.Write(sampler.IntervalReportCSVHeader()); err != nil {
+		logger.Error.Fatal(err)
+	}
+	for _, r := range reports {
+		if err := w.Write(r.CSVRow()); err != nil {
+			logger.Error.Fatal(err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		logger.Error.Fatal(err)
+	}
+}
+
+// simulateCmd replays synthetic or recorded /is-selected arrivals against a new slot curve, without touching the DB
+func simulateCmd(args []string) {
+	fs := flag.NewFlagSet(CMD_SIMULATE, flag.ExitOnError)
+	sourceKind := fs.String("source", getEnvOrDefault(ENV_SLOT_CURVE_SOURCE, sampler.SLOT_CURVE_SOURCE_SAMPLE_FILE), "curve source: sampleFile, histogram, schedule or jsonFile")
+	release := fs.String("release", getEnvOrDefault(ENV_SLOT_RELEASE_MODE, sampler.SLOT_RELEASE_STEP), "slot release mode: step or linear")
+	sampleFile := fs.String("sample-file", os.Getenv(ENV_SAMPLE_FILE_PATH), "file the curve (and synthetic arrivals) are drawn from")
+	target := fs.Int("target", getEnvIntOrDefault(ENV_TARGET_SAMPLE_COUNT, 0), "target number of samples in the interval")
+	openAtStart := fs.Int("open-at-start", getEnvIntOrDefault(ENV_OPEN_SLOTS_AT_INTERVAL_START, 0), "number of slots open at the interval start")
+	seed := fs.Int64("seed", rand.Int63(), "seed for drawing the slot curve")
+	start := fs.String("start", "", "date (YYYY-MM-DD) inside the simulated interval (default: current interval)")
+	arrivalCount := fs.Int("arrivals", 1000, "number of synthetic arrivals")
+	arrivalDist := fs.String("arrival-dist", "sample", "distribution of synthetic arrivals: sample or uniform")
+	arrivalSeed := fs.Int64("arrival-seed", rand.Int63(), "seed for drawing synthetic arrivals")
+	arrivalsFile := fs.String("arrivals-file", "", "CSV file with recorded arrivals (columns: time as unix timestamp or RFC3339, optional participantID, with header row), used instead of synthetic arrivals")
+	buckets := fs.Int("buckets", 7, "number of equally long parts of the interval in the distribution")
+	format := fs.String("format", "text", "output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		logger.Error.Fatal(err)
+	}
+	if *arrivalDist != "sample" && *arrivalDist != "uniform" {
+		logger.Error.Fatalf("unknown arrival distribution: %s", *arrivalDist)
+	}
+	if *format != "text" && *format != "json" {
+		logger.Error.Fatalf("unknown format: %s", *format)
+	}
+	if err := sampler.ValidateSlotRelease(*release); err != nil {
+		logger.Error.Fatal(err)
+	}
+
+	interval := getSamplingIntervalConfig()
+	source, err := newCurveSource(*sourceKind, *sampleFile, interval)
+	if err != nil {
+		logger.Error.Fatal(err)
+	}
+
+	conf := sampler.SimulationConfig{
+		Interval:         interval,
+		IntervalStart:    time.Now(),
+		Source:           source,
+		Release:          *release,
+		TargetSamples:    *target,
+		OpenSlotsAtStart: *openAtStart,
+		Seed:             *seed,
+		Buckets:          *buckets,
+	}
+	if *start != "" {
+		t, err := time.ParseInLocation("2006-01-02", *start, conf.Interval.Location)
+		if err != nil {
+			logger.Error.Fatal("start: " + err.Error())
+		}
+		conf.IntervalStart = t
+	}
+
+	var arrivals []sampler.Arrival
+	if *arrivalsFile != "" {
+		arrivals, err = readArrivalsFile(*arrivalsFile, conf.Interval)
+		if err != nil {
+			logger.Error.Fatal(err)
+		}
+	} else {
+		arrivals, err = sampler.SyntheticArrivals(conf, *arrivalCount, *arrivalDist == "uniform", *arrivalSeed)
+		if err != nil {
+			logger.Error.Fatal(err)
+		}
+	}
+
+	res, err := sampler.Simulate(conf, arrivals)
+	if err != nil {
+		logger.Error.Fatal(err)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			logger.Error.Fatal(err)
+		}
+		return
+	}
+
+	loc := conf.Interval.Location
+	fmt.Printf("interval:    %s - %s\n", time.Unix(res.IntervalStart, 0).In(loc).Format(time.RFC3339), time.Unix(res.IntervalEnd, 0).In(loc).Format(time.RFC3339))
+	fmt.Printf("seed:        %d\n", res.Seed)
+	fmt.Printf("target:      %d\n", res.Target)
+	fmt.Printf("arrivals:    %d\n", res.Arrivals)
+	fmt.Printf("selected:    %d\n", res.Selected)
+	fmt.Printf("turned away: %d\n", res.TurnedAway)
+	fmt.Printf("fill rate:   %.1f%% (%d / %d slots used)\n", res.FillRate*100, res.UsedSlots, res.Target)
+	fmt.Println()
+	fmt.Printf("%-25s %10s %10s\n", "from", "arrivals", "selected")
+	for _, b := range res.Distribution {
+		from := time.Unix(res.IntervalStart+b.Start, 0).In(loc).Format("2006-01-02 15:04 MST")
+		fmt.Printf("%-25s %10d %10d\n", from, b.Arrivals, b.Selected)
+	}
+}
+
+// readArrivalsFile reads recorded arrivals, each placed at its offset within its own interval
+func readArrivalsFile(filePath string, interval sampler.IntervalConfig) ([]sampler.Arrival, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("%s: no arrivals found", filePath)
+	}
+
+	arrivals := make([]sampler.Arrival, 0, len(records)-1)
+	for i, row := range records[1:] {
+		t, err := parseArrivalTime(row[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: row %d: %w", filePath, i+2, err)
+		}
+		participantID := fmt.Sprintf("participant-%d", i)
+		if len(row) > 1 && strings.TrimSpace(row[1]) != "" {
+			participantID = strings.TrimSpace(row[1])
+		}
+		arrivals = append(arrivals, sampler.Arrival{
+			T:             t.Unix() - interval.IntervalStartAt(t).Unix(),
+			ParticipantID: participantID,
+		})
+	}
+	return arrivals, nil
+}
+
+func parseArrivalTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/coneno/logger"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/entrycodes"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/ratelimit"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/sampler"
 	"github.com/infectieradar-nl/self-swabbing-extension/pkg/types"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/utils"
 )
 
 const (
@@ -18,8 +25,25 @@ const (
 	ENV_SELF_SWABBING_EXTENSION_LISTEN_PORT = "SELF_SWABBING_EXT_LISTEN_PORT"
 	ENV_CORS_ALLOW_ORIGINS                  = "CORS_ALLOW_ORIGINS"
 	ENV_API_KEYS                            = "API_KEYS"
+	ENV_ADMIN_API_KEYS                      = "ADMIN_API_KEYS"
 	ENV_ALLOW_ENTRY_CODE_UPLOAD             = "ALLOW_ENTRY_CODE_UPLOAD"
 
+	ENV_ENTRY_CODE_ALPHABET    = "ENTRY_CODE_ALPHABET"
+	ENV_ENTRY_CODE_LENGTH      = "ENTRY_CODE_LENGTH"
+	ENV_ENTRY_CODE_GROUP_SIZE  = "ENTRY_CODE_GROUP_SIZE"
+	ENV_ENTRY_CODE_CHECK_DIGIT = "ENTRY_CODE_CHECK_DIGIT"
+	ENV_ENTRY_CODE_HMAC_SECRET = "ENTRY_CODE_HMAC_SECRET"
+
+	ENV_TRUSTED_PROXIES                 = "TRUSTED_PROXIES"
+	ENV_CODE_ATTEMPT_LIMIT_BACKEND      = "CODE_ATTEMPT_LIMIT_BACKEND"
+	ENV_CODE_ATTEMPT_LIMIT_UID_FAILURES = "CODE_ATTEMPT_LIMIT_UID_MAX_FAILURES"
+	ENV_CODE_ATTEMPT_LIMIT_IP_FAILURES  = "CODE_ATTEMPT_LIMIT_IP_MAX_FAILURES"
+	ENV_CODE_ATTEMPT_LIMIT_WINDOW       = "CODE_ATTEMPT_LIMIT_WINDOW"
+	ENV_CODE_ATTEMPT_LIMIT_LOCKOUT      = "CODE_ATTEMPT_LIMIT_LOCKOUT"
+	ENV_CODE_ATTEMPT_LIMIT_LOCKOUT_MAX  = "CODE_ATTEMPT_LIMIT_LOCKOUT_MAX"
+	ENV_CODE_CHECK_RESPONSE_TIME        = "CODE_CHECK_RESPONSE_TIME"
+	ENV_CODE_CHECK_MAX_CONCURRENT       = "CODE_CHECK_MAX_CONCURRENT"
+
 	ENV_SELF_SWABBING_EXT_DB_CONNECTION_STR    = "SELF_SWABBING_EXT_DB_CONNECTION_STR"
 	ENV_SELF_SWABBING_EXT_DB_USERNAME          = "SELF_SWABBING_EXT_DB_USERNAME"
 	ENV_SELF_SWABBING_EXT_DB_PASSWORD          = "SELF_SWABBING_EXT_DB_PASSWORD"
@@ -30,10 +54,69 @@ const (
 	ENV_DB_MAX_POOL_SIZE     = "DB_MAX_POOL_SIZE"
 	ENV_DB_NAME_PREFIX       = "DB_DB_NAME_PREFIX"
 
+	ENV_SLOT_CURVE_SOURCE            = "SLOT_CURVE_SOURCE"
+	ENV_SLOT_CURVE_SCHEDULE          = "SLOT_CURVE_SCHEDULE"
+	ENV_SLOT_RELEASE_MODE            = "SLOT_RELEASE_MODE"
 	ENV_SAMPLE_FILE_PATH             = "SAMPLE_FILE_PATH"
+	ENV_SAMPLE_FILE_TIME_UNIT        = "SAMPLE_FILE_TIME_UNIT"
 	ENV_TARGET_SAMPLE_COUNT          = "TARGET_SAMPLE_COUNT"
 	ENV_OPEN_SLOTS_AT_INTERVAL_START = "OPEN_SLOTS_AT_INTERVAL_START"
 	ENV_MAX_PARTICIPANT_COUNT        = "MAX_PARTICIPANT_COUNT"
+	ENV_SAMPLING_INTERVAL            = "SAMPLING_INTERVAL"
+	ENV_SAMPLING_INTERVAL_WEEKDAY    = "SAMPLING_INTERVAL_START_WEEKDAY"
+	ENV_SAMPLING_INTERVAL_HOUR       = "SAMPLING_INTERVAL_START_HOUR"
+	ENV_SAMPLING_INTERVAL_ANCHOR     = "SAMPLING_INTERVAL_ANCHOR"
+	ENV_SAMPLING_TIMEZONE            = "SAMPLING_TIMEZONE"
+	ENV_SAMPLE_FILE_INTERVAL_LENGTH  = "SAMPLE_FILE_INTERVAL_LENGTH"
+	ENV_SAMPLER_SEED                 = "SAMPLER_SEED"
+	ENV_SAMPLER_STRATA_FILE          = "SAMPLER_STRATA_FILE"
+	ENV_SAMPLER_MIN_WEEKS_SINCE_SWAB = "SAMPLER_MIN_WEEKS_SINCE_LAST_SWAB"
+	ENV_SAMPLER_MAX_SWABS_PER_SEASON = "SAMPLER_MAX_SWABS_PER_SEASON"
+	ENV_SAMPLER_SEASON_START         = "SAMPLER_SEASON_START"
+	ENV_SAMPLER_MAX_DECLINES         = "SAMPLER_MAX_DECLINES"
+	ENV_SAMPLER_RESERVATION_TTL      = "SAMPLER_RESERVATION_TTL"
+	ENV_SAMPLER_RESERVATION_CHECK    = "SAMPLER_RESERVATION_CHECK_INTERVAL"
+	ENV_SAMPLER_CARRY_OVER_FRACTION  = "SAMPLER_CARRY_OVER_FRACTION"
+	ENV_SAMPLER_CARRY_OVER_MAX       = "SAMPLER_CARRY_OVER_MAX"
+	ENV_SAMPLER_ADAPTIVE_INTERVALS   = "SAMPLER_ADAPTIVE_INTERVALS"
+	ENV_SAMPLER_ADAPTIVE_WEIGHT      = "SAMPLER_ADAPTIVE_WEIGHT"
+	ENV_SAMPLER_ADAPTIVE_MIN_COUNT   = "SAMPLER_ADAPTIVE_MIN_ARRIVALS"
+	ENV_SAMPLER_BLACKOUTS            = "SAMPLER_BLACKOUTS"
+
+	ENV_SURVEY_ITEM_MATCH_MODE           = "SURVEY_ITEM_MATCH_MODE"
+	ENV_ENTRY_CODE_ITEM_KEY              = "ENTRY_CODE_ITEM_KEY"
+	ENV_ENTRY_CODE_RESPONSE_SLOT         = "ENTRY_CODE_RESPONSE_SLOT"
+	ENV_INVITE_RESPONSE_ITEM_KEY         = "INVITE_RESPONSE_ITEM_KEY"
+	ENV_INVITE_RESPONSE_RESPONSE_SLOT    = "INVITE_RESPONSE_RESPONSE_SLOT"
+	ENV_INVITE_RESPONSE_ACCEPTED_OPTIONS = "INVITE_RESPONSE_ACCEPTED_OPTIONS"
+)
+
+const (
+	defaultEntryCodeLength    = 10
+	defaultEntryCodeGroupSize = 5
+
+	defaultCodeAttemptUIDMaxFailures = 10
+	defaultCodeAttemptIPMaxFailures  = 50
+	defaultCodeAttemptWindow         = 5 * time.Minute
+	defaultCodeAttemptLockout        = 5 * time.Minute
+	defaultCodeAttemptLockoutMax     = 24 * time.Hour
+	defaultCodeCheckResponseTime     = 2 * time.Second
+	maxCodeCheckResponseTime         = 30 * time.Second
+	defaultCodeCheckMaxConcurrent    = 100
+
+	defaultSamplingIntervalAnchor = "2024-01-01"
+	defaultSamplerSeasonStart     = "10-01"
+	defaultReservationTTL         = 7 * 24 * time.Hour
+	defaultReservationCheck       = 15 * time.Minute
+	defaultAdaptiveWeight         = 0.5
+	defaultAdaptiveMinArrivals    = 100
+
+	defaultSurveyItemMatchMode           = string(utils.ItemMatchSuffix)
+	defaultEntryCodeItemKey              = "CodeVal"
+	defaultEntryCodeResponseSlot         = "rg.cv.ic"
+	defaultInviteResponseItemKey         = "SwabSample.Confirm"
+	defaultInviteResponseResponseSlot    = "rg.scg"
+	defaultInviteResponseAcceptedOptions = "1"
 )
 
 // Config is the structure that holds all global configuration data
@@ -42,11 +125,18 @@ type Config struct {
 	GinDebugMode         bool
 	Port                 string
 	AllowOrigins         []string
+	TrustedProxies       []string
 	APIKeys              []string
+	AdminAPIKeys         []string
 	AllowEntryCodeUpload bool
+	EntryCodeFormat      entrycodes.Format
+	EntryCodeSecret      string
+	CodeAttemptLimits    types.CodeAttemptLimitConfig
+	CodeCheckResponse    types.CodeCheckResponseConfig
 	LogLevel             logger.LogLevel
 	DBConfig             types.DBConfig
 	SamplerConfig        types.SamplerConfig
+	SurveyKeys           types.SurveyKeyMappings
 }
 
 func initConfig() Config {
@@ -55,12 +145,19 @@ func initConfig() Config {
 	conf.GinDebugMode = os.Getenv(ENV_GIN_DEBUG_MODE) == "true"
 	conf.Port = os.Getenv(ENV_SELF_SWABBING_EXTENSION_LISTEN_PORT)
 	conf.AllowOrigins = strings.Split(os.Getenv(ENV_CORS_ALLOW_ORIGINS), ",")
+	conf.TrustedProxies = splitAndTrim(os.Getenv(ENV_TRUSTED_PROXIES))
 	conf.APIKeys = strings.Split(os.Getenv(ENV_API_KEYS), ",")
+	conf.AdminAPIKeys = splitAndTrim(os.Getenv(ENV_ADMIN_API_KEYS))
 	conf.AllowEntryCodeUpload = os.Getenv(ENV_ALLOW_ENTRY_CODE_UPLOAD) == "true"
+	conf.EntryCodeFormat = getEntryCodeFormat()
+	conf.EntryCodeSecret = os.Getenv(ENV_ENTRY_CODE_HMAC_SECRET)
+	conf.CodeAttemptLimits = getCodeAttemptLimitConfig()
+	conf.CodeCheckResponse = getCodeCheckResponseConfig()
 
 	conf.LogLevel = getLogLevel()
 	conf.DBConfig = getDBConfig()
 	conf.SamplerConfig = getSamplerConfig()
+	conf.SurveyKeys = getSurveyKeyMappings()
 
 	return conf
 }
@@ -117,10 +214,12 @@ func getDBConfig() types.DBConfig {
 }
 
 func getSamplerConfig() types.SamplerConfig {
-	fp := os.Getenv(ENV_SAMPLE_FILE_PATH)
-	if fp == "" {
-		logger.Error.Fatal("sample file path must not be empty")
+	interval := getSamplingIntervalConfig()
+	source, err := newCurveSource(getEnvOrDefault(ENV_SLOT_CURVE_SOURCE, sampler.SLOT_CURVE_SOURCE_SAMPLE_FILE), os.Getenv(ENV_SAMPLE_FILE_PATH), interval)
+	if err != nil {
+		logger.Error.Fatal(err.Error())
 	}
+
 	ts, err := strconv.Atoi(os.Getenv(ENV_TARGET_SAMPLE_COUNT))
 	if err != nil {
 		logger.Error.Fatal(err.Error())
@@ -129,16 +228,444 @@ func getSamplerConfig() types.SamplerConfig {
 	if err != nil {
 		logger.Error.Fatal(err.Error())
 	}
+	if oss < 0 || ts < oss {
+		logger.Error.Fatal(ENV_TARGET_SAMPLE_COUNT + " must be at least " + ENV_OPEN_SLOTS_AT_INTERVAL_START + ", which must not be negative")
+	}
 
 	mpc, err := strconv.Atoi(os.Getenv(ENV_MAX_PARTICIPANT_COUNT))
 	if err != nil {
 		logger.Error.Fatal(ENV_MAX_PARTICIPANT_COUNT + ": " + err.Error())
 	}
 
-	return types.SamplerConfig{
-		SampleFilePath:      fp,
+	reservationTTL := getEnvDurationOrDefault(ENV_SAMPLER_RESERVATION_TTL, defaultReservationTTL)
+	if reservationTTL <= 0 {
+		logger.Error.Fatal(ENV_SAMPLER_RESERVATION_TTL + " must be positive")
+	}
+	reservationCheck := getEnvDurationOrDefault(ENV_SAMPLER_RESERVATION_CHECK, defaultReservationCheck)
+	if reservationCheck <= 0 {
+		logger.Error.Fatal(ENV_SAMPLER_RESERVATION_CHECK + " must be positive")
+	}
+
+	conf := types.SamplerConfig{
+		CurveSource:         source,
+		SlotRelease:         getSlotRelease(),
 		TargetSamples:       ts,
 		OpenSlotsAtStart:    oss,
 		MaxNrOfParticipants: int64(mpc),
+		Interval:            interval,
+		Seed:                getSamplerSeed(),
+		Strata:              getStrataConfig(),
+		Eligibility:         getEligibilityRules(),
+		ReservationTTL:      reservationTTL,
+		ReservationCheck:    reservationCheck,
+		CarryOver:           getCarryOverPolicy(),
+		Adaptive:            getAdaptiveConfig(),
+		Blackouts:           getBlackouts(interval.Location),
+	}
+	// a JSON curve is used as it is, it can't be split into strata or extended by carried over slots
+	if source.Kind() == sampler.SLOT_CURVE_SOURCE_JSON_FILE && (len(conf.Strata.Strata) > 0 || conf.CarryOver.Fraction > 0) {
+		logger.Error.Fatal(ENV_SLOT_CURVE_SOURCE + ": a JSON curve can't be used with strata or carry-over")
+	}
+	// recorded arrivals are blended with the times drawn from the curve source
+	if _, ok := source.(sampler.TimeSampler); conf.Adaptive.Intervals > 0 && !ok {
+		logger.Error.Fatal(ENV_SAMPLER_ADAPTIVE_INTERVALS + ": adaptive curves need the sampleFile or histogram source")
+	}
+	return conf
+}
+
+// newCurveSource creates the source new slot curves are drawn from, filePath is used by all sources except the schedule
+func newCurveSource(kind string, filePath string, interval sampler.IntervalConfig) (sampler.CurveSource, error) {
+	if kind != sampler.SLOT_CURVE_SOURCE_SCHEDULE && filePath == "" {
+		return nil, errors.New("sample file path must not be empty")
+	}
+
+	switch kind {
+	case sampler.SLOT_CURVE_SOURCE_SAMPLE_FILE:
+		timeUnit, err := parseTimeUnit(getEnvOrDefault(ENV_SAMPLE_FILE_TIME_UNIT, "minutes"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ENV_SAMPLE_FILE_TIME_UNIT, err)
+		}
+		return sampler.NewSampleFileSource(filePath, timeUnit, interval.SampleLength)
+	case sampler.SLOT_CURVE_SOURCE_HISTOGRAM:
+		return sampler.NewHistogramSource(filePath, interval.SampleLength)
+	case sampler.SLOT_CURVE_SOURCE_SCHEDULE:
+		points := sampler.UniformSchedule
+		if v := os.Getenv(ENV_SLOT_CURVE_SCHEDULE); v != "" {
+			var err error
+			points, err = sampler.ParseSchedule(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", ENV_SLOT_CURVE_SCHEDULE, err)
+			}
+		}
+		return sampler.NewScheduleSource(points)
+	case sampler.SLOT_CURVE_SOURCE_JSON_FILE:
+		return sampler.NewJSONCurveSource(filePath)
+	default:
+		return nil, fmt.Errorf("unknown slot curve source '%s', expected one of sampleFile, histogram, schedule or jsonFile", kind)
+	}
+}
+
+func parseTimeUnit(v string) (time.Duration, error) {
+	switch strings.ToLower(v) {
+	case "seconds":
+		return time.Second, nil
+	case "minutes":
+		return time.Minute, nil
+	case "hours":
+		return time.Hour, nil
+	default:
+		return 0, fmt.Errorf("unknown time unit '%s', expected seconds, minutes or hours", v)
+	}
+}
+
+func getCarryOverPolicy() sampler.CarryOverPolicy {
+	policy := sampler.CarryOverPolicy{
+		Fraction: getEnvFloatOrDefault(ENV_SAMPLER_CARRY_OVER_FRACTION, 0),
+		Max:      getEnvIntOrDefault(ENV_SAMPLER_CARRY_OVER_MAX, 0),
+	}
+	if policy.Fraction < 0 || policy.Fraction > 1 {
+		logger.Error.Fatal(ENV_SAMPLER_CARRY_OVER_FRACTION + " must be between 0 and 1")
+	}
+	if policy.Max < 0 {
+		logger.Error.Fatal(ENV_SAMPLER_CARRY_OVER_MAX + " must not be negative")
+	}
+	return policy
+}
+
+func getAdaptiveConfig() sampler.AdaptiveConfig {
+	conf := sampler.AdaptiveConfig{
+		Intervals:   getEnvIntOrDefault(ENV_SAMPLER_ADAPTIVE_INTERVALS, 0),
+		Weight:      getEnvFloatOrDefault(ENV_SAMPLER_ADAPTIVE_WEIGHT, defaultAdaptiveWeight),
+		MinArrivals: getEnvIntOrDefault(ENV_SAMPLER_ADAPTIVE_MIN_COUNT, defaultAdaptiveMinArrivals),
+	}
+	if conf.Intervals < 0 || conf.MinArrivals < 0 {
+		logger.Error.Fatal(ENV_SAMPLER_ADAPTIVE_INTERVALS + " and " + ENV_SAMPLER_ADAPTIVE_MIN_COUNT + " must not be negative")
+	}
+	if conf.Weight < 0 || conf.Weight > 1 {
+		logger.Error.Fatal(ENV_SAMPLER_ADAPTIVE_WEIGHT + " must be between 0 and 1")
+	}
+	return conf
+}
+
+func getSlotRelease() string {
+	release := getEnvOrDefault(ENV_SLOT_RELEASE_MODE, sampler.SLOT_RELEASE_STEP)
+	if err := sampler.ValidateSlotRelease(release); err != nil {
+		logger.Error.Fatal(ENV_SLOT_RELEASE_MODE + ": " + err.Error())
+	}
+	return release
+}
+
+func getBlackouts(loc *time.Location) []sampler.Blackout {
+	blackouts, err := sampler.ParseBlackouts(os.Getenv(ENV_SAMPLER_BLACKOUTS), loc)
+	if err != nil {
+		logger.Error.Fatal(ENV_SAMPLER_BLACKOUTS + ": " + err.Error())
+	}
+	return blackouts
+}
+
+func getEligibilityRules() sampler.EligibilityRules {
+	rules := sampler.EligibilityRules{
+		MinWeeksSinceLastSwab: getEnvIntOrDefault(ENV_SAMPLER_MIN_WEEKS_SINCE_SWAB, 0),
+		MaxSwabsPerSeason:     getEnvIntOrDefault(ENV_SAMPLER_MAX_SWABS_PER_SEASON, 0),
+		MaxDeclines:           getEnvIntOrDefault(ENV_SAMPLER_MAX_DECLINES, 0),
+	}
+	if rules.MinWeeksSinceLastSwab < 0 || rules.MaxSwabsPerSeason < 0 || rules.MaxDeclines < 0 {
+		logger.Error.Fatal("sampler eligibility rules must not be negative")
+	}
+
+	seasonStart, err := time.Parse("01-02", getEnvOrDefault(ENV_SAMPLER_SEASON_START, defaultSamplerSeasonStart))
+	if err != nil {
+		logger.Error.Fatal(ENV_SAMPLER_SEASON_START + ": expected MM-DD, " + err.Error())
+	}
+	rules.SeasonStartMonth = seasonStart.Month()
+	rules.SeasonStartDay = seasonStart.Day()
+	return rules
+}
+
+func getStrataConfig() types.StrataConfig {
+	conf := types.StrataConfig{}
+	fp := os.Getenv(ENV_SAMPLER_STRATA_FILE)
+	if fp == "" {
+		return conf
+	}
+
+	f, err := os.Open(fp)
+	if err != nil {
+		logger.Error.Fatal(ENV_SAMPLER_STRATA_FILE + ": " + err.Error())
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&conf); err != nil {
+		logger.Error.Fatal(ENV_SAMPLER_STRATA_FILE + ": " + err.Error())
+	}
+
+	for i := range conf.Attributes {
+		if conf.Attributes[i].Survey != nil && conf.Attributes[i].Survey.MatchMode == "" {
+			conf.Attributes[i].Survey.MatchMode = getEnvOrDefault(ENV_SURVEY_ITEM_MATCH_MODE, defaultSurveyItemMatchMode)
+		}
+	}
+	if err := validateStrataConfig(conf); err != nil {
+		logger.Error.Fatal("sampler strata: " + err.Error())
+	}
+	return conf
+}
+
+func validateStrataConfig(conf types.StrataConfig) error {
+	if len(conf.Attributes) < 1 {
+		return errors.New("at least one attribute is required")
+	}
+	for i, a := range conf.Attributes {
+		if (a.Flag == "") == (a.Survey == nil) {
+			return fmt.Errorf("attribute %d: exactly one of flag or survey must be set", i)
+		}
+		if a.Survey != nil {
+			if err := validateSurveyItemMapping(*a.Survey, false); err != nil {
+				return fmt.Errorf("attribute %d: %v", i, err)
+			}
+		}
+	}
+
+	if len(conf.Strata) < 1 {
+		return errors.New("at least one stratum is required")
+	}
+	keys := map[string]bool{}
+	for _, st := range conf.Strata {
+		if st.Key == "" {
+			return errors.New("stratum key must not be empty")
+		}
+		if keys[st.Key] {
+			return fmt.Errorf("stratum '%s' is defined twice", st.Key)
+		}
+		keys[st.Key] = true
+		if n := len(strings.Split(st.Key, "|")); n != len(conf.Attributes) {
+			return fmt.Errorf("stratum '%s' has %d values, expected one per attribute (%d)", st.Key, n, len(conf.Attributes))
+		}
+		if st.OpenSlotsAtStart < 0 || st.TargetSamples < st.OpenSlotsAtStart {
+			return fmt.Errorf("stratum '%s': targetSamples must be at least openSlotsAtStart, which must not be negative", st.Key)
+		}
+	}
+	if conf.DefaultStratum != "" && !keys[conf.DefaultStratum] {
+		return fmt.Errorf("default stratum '%s' is not defined", conf.DefaultStratum)
+	}
+	return nil
+}
+
+func getSamplerSeed() *int64 {
+	v := os.Getenv(ENV_SAMPLER_SEED)
+	if v == "" {
+		return nil
+	}
+	seed, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		logger.Error.Fatal(ENV_SAMPLER_SEED + ": " + err.Error())
+	}
+	return &seed
+}
+
+func getSamplingIntervalConfig() sampler.IntervalConfig {
+	conf := sampler.DefaultIntervalConfig()
+	conf.Length = getEnvOrDefault(ENV_SAMPLING_INTERVAL, conf.Length)
+	conf.StartHour = getEnvIntOrDefault(ENV_SAMPLING_INTERVAL_HOUR, conf.StartHour)
+	conf.SampleLength = getEnvDurationOrDefault(ENV_SAMPLE_FILE_INTERVAL_LENGTH, conf.SampleLength)
+
+	if v := os.Getenv(ENV_SAMPLING_INTERVAL_WEEKDAY); v != "" {
+		weekday, err := sampler.ParseWeekday(v)
+		if err != nil {
+			logger.Error.Fatal(ENV_SAMPLING_INTERVAL_WEEKDAY + ": " + err.Error())
+		}
+		conf.StartWeekday = weekday
+	}
+
+	anchor, err := time.Parse("2006-01-02", getEnvOrDefault(ENV_SAMPLING_INTERVAL_ANCHOR, defaultSamplingIntervalAnchor))
+	if err != nil {
+		logger.Error.Fatal(ENV_SAMPLING_INTERVAL_ANCHOR + ": " + err.Error())
+	}
+	conf.Anchor = anchor
+
+	if tz := os.Getenv(ENV_SAMPLING_TIMEZONE); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			logger.Error.Fatal(ENV_SAMPLING_TIMEZONE + ": " + err.Error())
+		}
+		conf.Location = loc
+	}
+
+	if err := conf.Validate(); err != nil {
+		logger.Error.Fatal("sampling interval: " + err.Error())
+	}
+	return conf
+}
+
+func getEntryCodeFormat() entrycodes.Format {
+	format := entrycodes.Format{
+		Alphabet:   getEnvOrDefault(ENV_ENTRY_CODE_ALPHABET, entrycodes.DefaultAlphabet),
+		Length:     getEnvIntOrDefault(ENV_ENTRY_CODE_LENGTH, defaultEntryCodeLength),
+		GroupSize:  getEnvIntOrDefault(ENV_ENTRY_CODE_GROUP_SIZE, defaultEntryCodeGroupSize),
+		CheckDigit: os.Getenv(ENV_ENTRY_CODE_CHECK_DIGIT) == "true",
+	}
+
+	if err := format.Validate(); err != nil {
+		logger.Error.Fatal("entry code format: " + err.Error())
+	}
+	return format
+}
+
+func getCodeAttemptLimitConfig() types.CodeAttemptLimitConfig {
+	window := getEnvDurationOrDefault(ENV_CODE_ATTEMPT_LIMIT_WINDOW, defaultCodeAttemptWindow)
+	lockout := getEnvDurationOrDefault(ENV_CODE_ATTEMPT_LIMIT_LOCKOUT, defaultCodeAttemptLockout)
+	lockoutMax := getEnvDurationOrDefault(ENV_CODE_ATTEMPT_LIMIT_LOCKOUT_MAX, defaultCodeAttemptLockoutMax)
+
+	conf := types.CodeAttemptLimitConfig{
+		Backend: getEnvOrDefault(ENV_CODE_ATTEMPT_LIMIT_BACKEND, types.RATE_LIMIT_BACKEND_MEMORY),
+		UID: ratelimit.Config{
+			MaxFailures: getEnvIntOrDefault(ENV_CODE_ATTEMPT_LIMIT_UID_FAILURES, defaultCodeAttemptUIDMaxFailures),
+			Window:      window,
+			LockoutBase: lockout,
+			LockoutMax:  lockoutMax,
+		},
+		IP: ratelimit.Config{
+			MaxFailures: getEnvIntOrDefault(ENV_CODE_ATTEMPT_LIMIT_IP_FAILURES, defaultCodeAttemptIPMaxFailures),
+			Window:      window,
+			LockoutBase: lockout,
+			LockoutMax:  lockoutMax,
+		},
+	}
+
+	if conf.Backend != types.RATE_LIMIT_BACKEND_MEMORY && conf.Backend != types.RATE_LIMIT_BACKEND_MONGO {
+		logger.Error.Fatalf("%s: unknown backend '%s', expected 'memory' or 'mongo'", ENV_CODE_ATTEMPT_LIMIT_BACKEND, conf.Backend)
+	}
+	if err := conf.UID.Validate(); err != nil {
+		logger.Error.Fatal("code attempt limit per uid: " + err.Error())
+	}
+	if conf.IP.MaxFailures != 0 {
+		if err := conf.IP.Validate(); err != nil {
+			logger.Error.Fatal("code attempt limit per IP: " + err.Error())
+		}
+	}
+	return conf
+}
+
+func getCodeCheckResponseConfig() types.CodeCheckResponseConfig {
+	conf := types.CodeCheckResponseConfig{
+		ResponseTime:  getEnvDurationOrDefault(ENV_CODE_CHECK_RESPONSE_TIME, defaultCodeCheckResponseTime),
+		MaxConcurrent: getEnvIntOrDefault(ENV_CODE_CHECK_MAX_CONCURRENT, defaultCodeCheckMaxConcurrent),
+	}
+	if conf.ResponseTime < 0 || conf.ResponseTime > maxCodeCheckResponseTime {
+		logger.Error.Fatalf("%s must be between 0 and %s", ENV_CODE_CHECK_RESPONSE_TIME, maxCodeCheckResponseTime)
+	}
+	if conf.MaxConcurrent < 1 {
+		logger.Error.Fatal(ENV_CODE_CHECK_MAX_CONCURRENT + " must be at least 1")
+	}
+	return conf
+}
+
+func getSurveyKeyMappings() types.SurveyKeyMappings {
+	matchMode := getEnvOrDefault(ENV_SURVEY_ITEM_MATCH_MODE, defaultSurveyItemMatchMode)
+	mappings := types.SurveyKeyMappings{
+		EntryCode: types.SurveyItemMapping{
+			ItemKey:      getEnvOrDefault(ENV_ENTRY_CODE_ITEM_KEY, defaultEntryCodeItemKey),
+			MatchMode:    matchMode,
+			ResponseSlot: getEnvOrDefault(ENV_ENTRY_CODE_RESPONSE_SLOT, defaultEntryCodeResponseSlot),
+		},
+		InviteResponse: types.SurveyItemMapping{
+			ItemKey:         getEnvOrDefault(ENV_INVITE_RESPONSE_ITEM_KEY, defaultInviteResponseItemKey),
+			MatchMode:       matchMode,
+			ResponseSlot:    getEnvOrDefault(ENV_INVITE_RESPONSE_RESPONSE_SLOT, defaultInviteResponseResponseSlot),
+			AcceptedOptions: splitAndTrim(getEnvOrDefault(ENV_INVITE_RESPONSE_ACCEPTED_OPTIONS, defaultInviteResponseAcceptedOptions)),
+		},
+	}
+
+	if err := validateSurveyItemMapping(mappings.EntryCode, false); err != nil {
+		logger.Error.Fatal("entry code survey mapping: " + err.Error())
+	}
+	if err := validateSurveyItemMapping(mappings.InviteResponse, true); err != nil {
+		logger.Error.Fatal("invite response survey mapping: " + err.Error())
+	}
+	return mappings
+}
+
+func validateSurveyItemMapping(m types.SurveyItemMapping, requireOptions bool) error {
+	if m.ItemKey == "" {
+		return errors.New("survey item key must not be empty")
+	}
+	for _, part := range strings.Split(m.ItemKey, ".") {
+		if part == "" {
+			return fmt.Errorf("survey item key '%s' contains an empty segment", m.ItemKey)
+		}
+	}
+	if !utils.IsValidItemMatchMode(utils.ItemMatchMode(m.MatchMode)) {
+		return fmt.Errorf("unknown item match mode '%s', expected one of: exact, suffix, path", m.MatchMode)
+	}
+	if err := utils.ValidateItemKeyForMode(m.ItemKey, utils.ItemMatchMode(m.MatchMode)); err != nil {
+		return err
+	}
+	if m.ResponseSlot == "" {
+		return errors.New("response slot must not be empty")
+	}
+	for _, part := range strings.Split(m.ResponseSlot, ".") {
+		if part == "" {
+			return fmt.Errorf("response slot '%s' contains an empty segment", m.ResponseSlot)
+		}
+	}
+	if requireOptions && len(m.AcceptedOptions) < 1 {
+		return errors.New("at least one accepted option key is required")
+	}
+	return nil
+}
+
+func getEnvOrDefault(key string, defaultValue string) string {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultValue
+	}
+	return v
+}
+
+func getEnvIntOrDefault(key string, defaultValue int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		logger.Error.Fatal(key + ": " + err.Error())
+	}
+	return i
+}
+
+func getEnvFloatOrDefault(key string, defaultValue float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		logger.Error.Fatal(key + ": " + err.Error())
+	}
+	return f
+}
+
+func getEnvDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		logger.Error.Fatal(key + ": " + err.Error())
+	}
+	return d
+}
+
+func splitAndTrim(value string) []string {
+	res := []string{}
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			res = append(res, v)
+		}
 	}
+	return res
 }
@@ -2,23 +2,24 @@ package main
 
 import (
 	"net/http"
+	"os"
 	"time"
+	_ "time/tzdata" // timezones for SAMPLING_TIMEZONE in minimal containers
 
 	"github.com/coneno/logger"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/infectieradar-nl/self-swabbing-extension/pkg/db"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/entrycodes"
 	"github.com/infectieradar-nl/self-swabbing-extension/pkg/http/handlers"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/ratelimit"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/types"
 )
 
 var conf Config
 
 func init() {
-	conf = initConfig()
-	if !conf.GinDebugMode {
-		gin.SetMode(gin.ReleaseMode)
-	}
-	logger.SetLevel(conf.LogLevel)
+	logger.SetLevel(getLogLevel())
 }
 
 func healthCheckHandle(c *gin.Context) {
@@ -26,13 +27,35 @@ func healthCheckHandle(c *gin.Context) {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
+	conf = initConfig()
+	if !conf.GinDebugMode {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
 	logger.Info.Println("Starting self-swabbing-extension")
 
-	dbService := db.NewSelfSwabbingExtDBService(conf.DBConfig)
+	if conf.EntryCodeSecret == "" {
+		logger.Warning.Println(ENV_ENTRY_CODE_HMAC_SECRET + " is not set, entry codes are stored in plain text")
+	}
+	dbService := db.NewSelfSwabbingExtDBService(conf.DBConfig, entrycodes.NewHasher(conf.EntryCodeSecret))
 	dbService.CreateIndexesForSampler(conf.InstanceID)
 
+	go expireSlotReservations(conf.InstanceID, conf.SamplerConfig, dbService)
+
+	uidLimiter, ipLimiter := newCodeAttemptLimiters(conf.InstanceID, conf.CodeAttemptLimits, dbService)
+
 	// Start webserver
 	router := gin.Default()
+	if len(conf.TrustedProxies) > 0 {
+		if err := router.SetTrustedProxies(conf.TrustedProxies); err != nil {
+			logger.Error.Fatal(ENV_TRUSTED_PROXIES + ": " + err.Error())
+		}
+	}
 	router.Use(cors.New(cors.Config{
 		// AllowAllOrigins: true,
 		AllowOrigins:     conf.AllowOrigins,
@@ -49,12 +72,56 @@ func main() {
 		conf.InstanceID,
 		dbService,
 		conf.APIKeys,
+		conf.AdminAPIKeys,
 		conf.AllowEntryCodeUpload,
+		conf.EntryCodeFormat,
+		uidLimiter,
+		ipLimiter,
+		conf.CodeCheckResponse,
 		conf.SamplerConfig,
+		conf.SurveyKeys,
 	)
 	apiHandlers.AddCodeCheckerAPI(apiRoot)
+	apiHandlers.AddEntryCodeAdminAPI(apiRoot)
 	apiHandlers.AddSamplerAPI(apiRoot)
+	apiHandlers.AddSamplerAdminAPI(apiRoot)
 
 	logger.Info.Printf("self swabbing extension is listening on port %s", conf.Port)
 	logger.Error.Fatal(router.Run(":" + conf.Port))
 }
+
+// newCodeAttemptLimiters creates the limiters for wrong entry code attempts, the IP limiter is nil if disabled
+func newCodeAttemptLimiters(instanceID string, conf types.CodeAttemptLimitConfig, dbService *db.SelfSwabbingExtDBService) (uidLimiter ratelimit.Limiter, ipLimiter ratelimit.Limiter) {
+	newLimiter := func(cfg ratelimit.Config) ratelimit.Limiter {
+		if conf.Backend == types.RATE_LIMIT_BACKEND_MONGO {
+			return ratelimit.NewMongoLimiter(cfg, instanceID, dbService)
+		}
+		return ratelimit.NewMemoryLimiter(cfg)
+	}
+
+	if conf.Backend == types.RATE_LIMIT_BACKEND_MONGO {
+		dbService.CreateIndexesForRateLimits(instanceID)
+	}
+
+	uidLimiter = newLimiter(conf.UID)
+	if conf.IP.MaxFailures > 0 {
+		ipLimiter = newLimiter(conf.IP)
+	}
+	return uidLimiter, ipLimiter
+}
+
+// expireSlotReservations releases the slots of reservations without invite response, runs until the process exits
+func expireSlotReservations(instanceID string, conf types.SamplerConfig, dbService *db.SelfSwabbingExtDBService) {
+	ticker := time.NewTicker(conf.ReservationCheck)
+	defer ticker.Stop()
+
+	for {
+		count, err := dbService.ExpireSlotReservations(instanceID, conf.ReservationTTL)
+		if err != nil {
+			logger.Error.Printf("error when expiring slot reservations: %v", err)
+		} else if count > 0 {
+			logger.Info.Printf("%d slot reservations expired", count)
+		}
+		<-ticker.C
+	}
+}
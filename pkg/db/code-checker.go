@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -15,24 +16,34 @@ func (dbService *SelfSwabbingExtDBService) CreateIndexForEntryCodes(instanceID s
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
-	_, err := dbService.collectionRefEntryCodes(instanceID).Indexes().CreateOne(
-		ctx, mongo.IndexModel{
-			Keys: bson.M{
-				"code": 1,
+	_, err := dbService.collectionRefEntryCodes(instanceID).Indexes().CreateMany(
+		ctx, []mongo.IndexModel{
+			{
+				Keys: bson.M{
+					"code": 1,
+				},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.M{
+					"batchID": 1,
+				},
 			},
-			Options: options.Index().SetUnique(true),
 		},
 	)
 	return err
 }
 
-func (dbService *SelfSwabbingExtDBService) AddEntryCode(instanceID string, entryCode string) (string, error) {
+func (dbService *SelfSwabbingExtDBService) AddEntryCode(instanceID string, entryCode string, batchInfo types.CodeBatchInfo) (string, error) {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
 	newEntryCode := types.ValidationCode{
-		Code:       entryCode,
-		UploadedAt: time.Now().Unix(),
+		Code:          dbService.codeHasher.Hash(entryCode),
+		Hashed:        dbService.codeHasher.Enabled(),
+		CodeBatchInfo: batchInfo,
+		Status:        types.ENTRY_CODE_STATUS_AVAILABLE,
+		UploadedAt:    time.Now().Unix(),
 	}
 
 	res, err := dbService.collectionRefEntryCodes(instanceID).InsertOne(ctx, newEntryCode)
@@ -43,12 +54,87 @@ func (dbService *SelfSwabbingExtDBService) AddEntryCode(instanceID string, entry
 	return id.Hex(), err
 }
 
+// AddEntryCodes inserts the codes (with their batch info) in one unordered bulk write and returns the codes rejected because they already exist
+func (dbService *SelfSwabbingExtDBService) AddEntryCodes(instanceID string, entryCodes []types.ValidationCode) (duplicates map[string]bool, err error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	duplicates = map[string]bool{}
+	if len(entryCodes) < 1 {
+		return duplicates, nil
+	}
+
+	now := time.Now().Unix()
+	docs := make([]interface{}, len(entryCodes))
+	for i, c := range entryCodes {
+		docs[i] = types.ValidationCode{
+			Code:          dbService.codeHasher.Hash(c.Code),
+			Hashed:        dbService.codeHasher.Enabled(),
+			CodeBatchInfo: c.CodeBatchInfo,
+			Status:        types.ENTRY_CODE_STATUS_AVAILABLE,
+			UploadedAt:    now,
+		}
+	}
+
+	_, err = dbService.collectionRefEntryCodes(instanceID).InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		return duplicates, nil
+	}
+
+	var bwe mongo.BulkWriteException
+	if !errors.As(err, &bwe) || bwe.WriteConcernError != nil {
+		return duplicates, err
+	}
+	for _, we := range bwe.WriteErrors {
+		if !mongo.IsDuplicateKeyError(we) {
+			return duplicates, err
+		}
+		duplicates[entryCodes[we.Index].Code] = true
+	}
+	return duplicates, nil
+}
+
+// FindExistingEntryCodes returns which of the given codes are already stored
+func (dbService *SelfSwabbingExtDBService) FindExistingEntryCodes(instanceID string, entryCodes []string) (existing map[string]bool, err error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	existing = map[string]bool{}
+	if len(entryCodes) < 1 {
+		return existing, nil
+	}
+
+	codesByHash := make(map[string]string, len(entryCodes))
+	hashes := make([]string, len(entryCodes))
+	for i, c := range entryCodes {
+		hashes[i] = dbService.codeHasher.Hash(c)
+		codesByHash[hashes[i]] = c
+	}
+
+	filter := bson.M{"code": bson.M{"$in": hashes}}
+	opts := options.Find().SetProjection(bson.M{"code": 1})
+	cur, err := dbService.collectionRefEntryCodes(instanceID).Find(ctx, filter, opts)
+	if err != nil {
+		return existing, err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var vc types.ValidationCode
+		if err := cur.Decode(&vc); err != nil {
+			return existing, err
+		}
+		existing[codesByHash[vc.Code]] = true
+	}
+	return existing, cur.Err()
+}
+
 func (dbService *SelfSwabbingExtDBService) FindEntryCodeInfo(instanceID string, code string) (entryCode types.ValidationCode, err error) {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
 	filter := bson.M{
-		"code": code,
+		"code": dbService.codeHasher.Hash(code),
 	}
 
 	if err = dbService.collectionRefEntryCodes(instanceID).FindOne(
@@ -79,15 +165,17 @@ func (dbService *SelfSwabbingExtDBService) MarkEntryCodeAsUsed(instanceID string
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
+	now := time.Now().Unix()
 	filter := bson.M{
 		"$and": bson.A{
-			bson.M{"code": code},
-			bson.M{"usedAt": bson.M{"$lt": 1}},
+			bson.M{"code": dbService.codeHasher.Hash(code)},
+			entryCodeStatusToBSON(types.ENTRY_CODE_STATUS_AVAILABLE, now),
 		},
 	}
 	update := bson.M{"$set": bson.M{
-		"usedAt": time.Now().Unix(),
+		"usedAt": now,
 		"usedBy": usedBy,
+		"status": types.ENTRY_CODE_STATUS_USED,
 	}}
 	res, err := dbService.collectionRefEntryCodes(instanceID).UpdateOne(ctx, filter, update)
 	if err != nil {
@@ -98,3 +186,203 @@ func (dbService *SelfSwabbingExtDBService) MarkEntryCodeAsUsed(instanceID string
 	}
 	return nil
 }
+
+func entryCodeFilterToBSON(filter types.EntryCodeFilter) bson.M {
+	q := bson.M{}
+	if filter.Used != nil {
+		if *filter.Used {
+			q["usedAt"] = bson.M{"$gt": 0}
+		} else {
+			q["usedAt"] = bson.M{"$lt": 1}
+		}
+	}
+	if filter.UploadedFrom > 0 || filter.UploadedUntil > 0 {
+		uploadedAt := bson.M{}
+		if filter.UploadedFrom > 0 {
+			uploadedAt["$gte"] = filter.UploadedFrom
+		}
+		if filter.UploadedUntil > 0 {
+			uploadedAt["$lte"] = filter.UploadedUntil
+		}
+		q["uploadedAt"] = uploadedAt
+	}
+	if filter.UsedBy != "" {
+		q["usedBy"] = filter.UsedBy
+	}
+	if filter.BatchID != "" {
+		q["batchID"] = filter.BatchID
+	}
+	if filter.Status != "" {
+		q["$and"] = bson.A{entryCodeStatusToBSON(filter.Status, time.Now().Unix())}
+	}
+	return q
+}
+
+// entryCodeStatusToBSON matches codes by their effective status (see types.ValidationCode.EffectiveStatus)
+func entryCodeStatusToBSON(status string, now int64) bson.M {
+	unused := bson.M{"usedAt": bson.M{"$lt": 1}}
+	// codes stored before statuses were introduced have no status field
+	notRevoked := bson.M{"status": bson.M{"$in": bson.A{types.ENTRY_CODE_STATUS_AVAILABLE, nil}}}
+	notExpired := bson.M{"$or": bson.A{
+		bson.M{"expiresAt": bson.M{"$exists": false}},
+		bson.M{"expiresAt": bson.M{"$lt": 1}},
+		bson.M{"expiresAt": bson.M{"$gt": now}},
+	}}
+
+	switch status {
+	case types.ENTRY_CODE_STATUS_AVAILABLE:
+		return bson.M{"$and": bson.A{unused, notRevoked, notExpired}}
+	case types.ENTRY_CODE_STATUS_USED:
+		return bson.M{"usedAt": bson.M{"$gt": 0}}
+	case types.ENTRY_CODE_STATUS_REVOKED:
+		return bson.M{"$and": bson.A{unused, bson.M{"status": types.ENTRY_CODE_STATUS_REVOKED}}}
+	case types.ENTRY_CODE_STATUS_EXPIRED:
+		return bson.M{"$and": bson.A{unused, bson.M{"$or": bson.A{
+			bson.M{"status": types.ENTRY_CODE_STATUS_EXPIRED},
+			bson.M{"$and": bson.A{notRevoked, bson.M{"expiresAt": bson.M{"$gt": 0, "$lte": now}}}},
+		}}}}
+	}
+	// unknown status, match nothing
+	return bson.M{"status": bson.M{"$in": bson.A{}}}
+}
+
+func (dbService *SelfSwabbingExtDBService) FindEntryCodes(instanceID string, filter types.EntryCodeFilter, page int64, limit int64) (codes []types.ValidationCode, total int64, err error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	q := entryCodeFilterToBSON(filter)
+	total, err = dbService.collectionRefEntryCodes(instanceID).CountDocuments(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "uploadedAt", Value: 1}, {Key: "_id", Value: 1}})
+	opts.SetSkip((page - 1) * limit)
+	opts.SetLimit(limit)
+
+	cur, err := dbService.collectionRefEntryCodes(instanceID).Find(ctx, q, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+
+	codes = []types.ValidationCode{}
+	if err = cur.All(ctx, &codes); err != nil {
+		return nil, 0, err
+	}
+	return codes, total, nil
+}
+
+// StreamEntryCodes calls onCode for each entry code matching the filter, stops at the first error returned by onCode
+func (dbService *SelfSwabbingExtDBService) StreamEntryCodes(ctx context.Context, instanceID string, filter types.EntryCodeFilter, onCode func(code types.ValidationCode) error) error {
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "uploadedAt", Value: 1}, {Key: "_id", Value: 1}})
+
+	cur, err := dbService.collectionRefEntryCodes(instanceID).Find(ctx, entryCodeFilterToBSON(filter), opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var code types.ValidationCode
+		if err := cur.Decode(&code); err != nil {
+			return err
+		}
+		if err := onCode(code); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+// RevokeEntryCodeBatch marks all unused codes of the batch as revoked, returns the number of revoked codes
+func (dbService *SelfSwabbingExtDBService) RevokeEntryCodeBatch(instanceID string, batchID string) (int64, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{
+		"batchID": batchID,
+		"usedAt":  bson.M{"$lt": 1},
+		"status":  bson.M{"$ne": types.ENTRY_CODE_STATUS_REVOKED},
+	}
+	update := bson.M{"$set": bson.M{"status": types.ENTRY_CODE_STATUS_REVOKED}}
+	res, err := dbService.collectionRefEntryCodes(instanceID).UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// ReactivateEntryCodeBatch makes revoked codes of the batch available again, returns the number of reactivated codes
+func (dbService *SelfSwabbingExtDBService) ReactivateEntryCodeBatch(instanceID string, batchID string) (int64, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{
+		"batchID": batchID,
+		"usedAt":  bson.M{"$lt": 1},
+		"status":  types.ENTRY_CODE_STATUS_REVOKED,
+	}
+	update := bson.M{"$set": bson.M{"status": types.ENTRY_CODE_STATUS_AVAILABLE}}
+	res, err := dbService.collectionRefEntryCodes(instanceID).UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// HashPlaintextEntryCodes replaces the code of every document not hashed yet with its keyed hash, returns the number of converted codes
+func (dbService *SelfSwabbingExtDBService) HashPlaintextEntryCodes(instanceID string) (count int64, err error) {
+	if !dbService.codeHasher.Enabled() {
+		return 0, errors.New("entry code hashing is not configured")
+	}
+
+	ctx := context.Background()
+	filter := bson.M{"hashed": bson.M{"$ne": true}}
+	opts := options.Find().SetProjection(bson.M{"code": 1})
+	cur, err := dbService.collectionRefEntryCodes(instanceID).Find(ctx, filter, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	updates := []mongo.WriteModel{}
+	flush := func() error {
+		if len(updates) < 1 {
+			return nil
+		}
+		ctx, cancel := dbService.getContext()
+		defer cancel()
+		res, err := dbService.collectionRefEntryCodes(instanceID).BulkWrite(ctx, updates)
+		if res != nil {
+			count += res.ModifiedCount
+		}
+		updates = updates[:0]
+		return err
+	}
+
+	for cur.Next(ctx) {
+		var vc types.ValidationCode
+		if err := cur.Decode(&vc); err != nil {
+			return count, err
+		}
+		updates = append(updates, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": vc.ID, "hashed": bson.M{"$ne": true}}).
+			SetUpdate(bson.M{"$set": bson.M{
+				"code":   dbService.codeHasher.Hash(vc.Code),
+				"hashed": true,
+			}}),
+		)
+		if len(updates) >= 1000 {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return count, err
+	}
+	return count, flush()
+}
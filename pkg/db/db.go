@@ -2,9 +2,11 @@ package db
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/coneno/logger"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/entrycodes"
 	"github.com/infectieradar-nl/self-swabbing-extension/pkg/types"
 
 	"go.mongodb.org/mongo-driver/mongo"
@@ -15,9 +17,10 @@ type SelfSwabbingExtDBService struct {
 	DBClient     *mongo.Client
 	timeout      int
 	DBNamePrefix string
+	codeHasher   entrycodes.Hasher
 }
 
-func NewSelfSwabbingExtDBService(configs types.DBConfig) *SelfSwabbingExtDBService {
+func NewSelfSwabbingExtDBService(configs types.DBConfig, codeHasher entrycodes.Hasher) *SelfSwabbingExtDBService {
 	var err error
 	dbClient, err := mongo.NewClient(
 		options.Client().ApplyURI(configs.URI),
@@ -47,6 +50,7 @@ func NewSelfSwabbingExtDBService(configs types.DBConfig) *SelfSwabbingExtDBServi
 		DBClient:     dbClient,
 		timeout:      configs.Timeout,
 		DBNamePrefix: configs.DBNamePrefix,
+		codeHasher:   codeHasher,
 	}
 	return ContentDBService
 }
@@ -64,7 +68,32 @@ func (dbService *SelfSwabbingExtDBService) collectionRefUsedSlots(instanceID str
 	return dbService.DBClient.Database(dbService.DBNamePrefix + instanceID + "_self-swabbing-ext").Collection("used-slots")
 }
 
+func (dbService *SelfSwabbingExtDBService) collectionRefSlotCounters(instanceID string) *mongo.Collection {
+	return dbService.DBClient.Database(dbService.DBNamePrefix + instanceID + "_self-swabbing-ext").Collection("slot-counters")
+}
+
+func (dbService *SelfSwabbingExtDBService) collectionRefArrivals(instanceID string) *mongo.Collection {
+	return dbService.DBClient.Database(dbService.DBNamePrefix + instanceID + "_self-swabbing-ext").Collection("arrivals")
+}
+
+func (dbService *SelfSwabbingExtDBService) collectionRefSamplerState(instanceID string) *mongo.Collection {
+	return dbService.DBClient.Database(dbService.DBNamePrefix + instanceID + "_self-swabbing-ext").Collection("sampler-state")
+}
+
+func (dbService *SelfSwabbingExtDBService) collectionRefRateLimits(instanceID string) *mongo.Collection {
+	return dbService.DBClient.Database(dbService.DBNamePrefix + instanceID + "_self-swabbing-ext").Collection("rate-limits")
+}
+
 // DB utils
 func (dbService *SelfSwabbingExtDBService) getContext() (ctx context.Context, cancel context.CancelFunc) {
 	return context.WithTimeout(context.Background(), time.Duration(dbService.timeout)*time.Second)
 }
+
+// isIndexNotFoundError is true if an index could not be dropped because it (or its collection) doesn't exist
+func isIndexNotFoundError(err error) bool {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.Code == 26 || cmdErr.Code == 27 // NamespaceNotFound, IndexNotFound
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/coneno/logger"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/ratelimit"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (dbService *SelfSwabbingExtDBService) CreateIndexesForRateLimits(instanceID string) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	_, err := dbService.collectionRefRateLimits(instanceID).Indexes().CreateMany(
+		ctx, []mongo.IndexModel{
+			{
+				Keys: bson.M{
+					"key": 1,
+				},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys: bson.M{
+					"expiresAt": 1,
+				},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+	)
+	if err != nil {
+		logger.Error.Println(err)
+	}
+}
+
+// LoadRateLimitState returns the state of the key, or an empty state if the key has no history
+func (dbService *SelfSwabbingExtDBService) LoadRateLimitState(instanceID string, key string) (state ratelimit.State, err error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	err = dbService.collectionRefRateLimits(instanceID).FindOne(ctx, bson.M{"key": key}).Decode(&state)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ratelimit.State{Key: key}, nil
+	}
+	return state, err
+}
+
+// SaveRateLimitState stores the state if the stored version still equals expectedVersion, saved is false otherwise
+func (dbService *SelfSwabbingExtDBService) SaveRateLimitState(instanceID string, state ratelimit.State, expectedVersion int64) (saved bool, err error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	if expectedVersion == 0 {
+		_, err = dbService.collectionRefRateLimits(instanceID).InsertOne(ctx, state)
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	filter := bson.M{
+		"key":     state.Key,
+		"version": expectedVersion,
+	}
+	res, err := dbService.collectionRefRateLimits(instanceID).ReplaceOne(ctx, filter, state)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"time"
+
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/sampler"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// FindLatestSlotCurves returns the latest version of every interval's slot curve with intervalStart in [from, until], oldest first.
+// A zero until means no upper limit. versions holds the number of stored versions per intervalStart.
+func (dbService *SelfSwabbingExtDBService) FindLatestSlotCurves(instanceID string, from int64, until int64) (curves []sampler.SlotCurve, versions map[int64]int, err error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	intervalFilter := bson.M{"$gte": from}
+	if until > 0 {
+		intervalFilter["$lte"] = until
+	}
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{"intervalStart": intervalFilter}},
+		bson.M{"$sort": bson.D{{Key: "intervalStart", Value: 1}, {Key: "version", Value: -1}}},
+		bson.M{"$group": bson.M{
+			"_id":      "$intervalStart",
+			"curve":    bson.M{"$first": "$$ROOT"},
+			"versions": bson.M{"$sum": 1},
+		}},
+		bson.M{"$sort": bson.M{"_id": 1}},
+	}
+
+	cur, err := dbService.collectionRefSlotCurves(instanceID).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cur.Close(ctx)
+
+	var groups []struct {
+		Curve    sampler.SlotCurve `bson:"curve"`
+		Versions int               `bson:"versions"`
+	}
+	if err := cur.All(ctx, &groups); err != nil {
+		return nil, nil, err
+	}
+
+	curves = make([]sampler.SlotCurve, len(groups))
+	versions = make(map[int64]int, len(groups))
+	for i, g := range groups {
+		curves[i] = g.Curve
+		versions[g.Curve.IntervalStart] = g.Versions
+	}
+	return curves, versions, nil
+}
+
+// FindUsedSlotsBetween returns all slots (of any status) reserved in [from, until)
+func (dbService *SelfSwabbingExtDBService) FindUsedSlotsBetween(instanceID string, from int64, until int64) (slots []UsedSlot, err error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{"time": bson.M{"$gte": from, "$lt": until}}
+	cur, err := dbService.collectionRefUsedSlots(instanceID).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	slots = []UsedSlot{}
+	err = cur.All(ctx, &slots)
+	return slots, err
+}
+
+// GetSamplerReport evaluates every interval with a slot curve and intervalStart in [from, until] (zero until: no limit).
+// Curves stored before the interval end was recorded use the end given by the interval config.
+func (dbService *SelfSwabbingExtDBService) GetSamplerReport(instanceID string, interval sampler.IntervalConfig, from int64, until int64) ([]sampler.IntervalReport, error) {
+	curves, versions, err := dbService.FindLatestSlotCurves(instanceID, from, until)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	reports := make([]sampler.IntervalReport, 0, len(curves))
+	for _, curve := range curves {
+		intervalEnd := curve.IntervalEnd
+		if intervalEnd == 0 {
+			intervalEnd = interval.IntervalEnd(time.Unix(curve.IntervalStart, 0)).Unix()
+		}
+
+		slots, err := dbService.FindUsedSlotsBetween(instanceID, curve.IntervalStart, intervalEnd)
+		if err != nil {
+			return nil, err
+		}
+
+		usages := make([]sampler.SlotUsage, len(slots))
+		for i, slot := range slots {
+			releasedAt := slot.CancelledAt
+			if slot.Status == USED_SLOT_STATUS_EXPIRED {
+				releasedAt = slot.ExpiredAt
+			}
+			usages[i] = sampler.SlotUsage{Time: slot.Time, ReleasedAt: releasedAt}
+		}
+		report := sampler.EvaluateInterval(curve, intervalEnd, usages, now)
+		report.CurveVersions = versions[curve.IntervalStart]
+		report.Reservations = len(slots)
+		for _, slot := range slots {
+			switch slot.Status {
+			case USED_SLOT_STATUS_RESERVED:
+				report.Reserved += 1
+			case USED_SLOT_STATUS_CONFIRMED:
+				report.Confirmed += 1
+			case USED_SLOT_STATUS_CANCELLED:
+				report.Cancelled += 1
+			case USED_SLOT_STATUS_EXPIRED:
+				report.Expired += 1
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
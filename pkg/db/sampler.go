@@ -1,11 +1,14 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"github.com/coneno/logger"
 	"github.com/infectieradar-nl/self-swabbing-extension/pkg/sampler"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -14,10 +17,17 @@ func (dbService *SelfSwabbingExtDBService) CreateIndexesForSampler(instanceID st
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
-	_, err := dbService.collectionRefSlotCurves(instanceID).Indexes().CreateOne(
+	// slot curves used to be unique per interval, now every change is stored as a new version
+	_, err := dbService.collectionRefSlotCurves(instanceID).Indexes().DropOne(ctx, "intervalStart_-1")
+	if err != nil && !isIndexNotFoundError(err) {
+		logger.Error.Println(err)
+	}
+
+	_, err = dbService.collectionRefSlotCurves(instanceID).Indexes().CreateOne(
 		ctx, mongo.IndexModel{
-			Keys: bson.M{
-				"intervalStart": -1,
+			Keys: bson.D{
+				{Key: "intervalStart", Value: -1},
+				{Key: "version", Value: -1},
 			},
 			Options: options.Index().SetUnique(true),
 		},
@@ -48,15 +58,81 @@ func (dbService *SelfSwabbingExtDBService) CreateIndexesForSampler(instanceID st
 	if err != nil {
 		logger.Error.Println(err)
 	}
+
+	_, err = dbService.collectionRefUsedSlots(instanceID).Indexes().CreateOne(
+		ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "participantID", Value: 1},
+				{Key: "status", Value: 1},
+			},
+		},
+	)
+	if err != nil {
+		logger.Error.Println(err)
+	}
+
+	// a participant can only have one open reservation, also if two instances reserve a slot for them at the same time
+	_, err = dbService.collectionRefUsedSlots(instanceID).Indexes().CreateOne(
+		ctx, mongo.IndexModel{
+			Keys: bson.M{
+				"participantID": 1,
+			},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"status": USED_SLOT_STATUS_RESERVED,
+			}),
+		},
+	)
+	if err != nil {
+		logger.Error.Println(err)
+	}
+
+	_, err = dbService.collectionRefArrivals(instanceID).Indexes().CreateMany(
+		ctx, []mongo.IndexModel{
+			{
+				Keys: bson.M{
+					"time": -1,
+				},
+			},
+			{
+				Keys: bson.M{
+					"expiresAt": 1,
+				},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		},
+	)
+	if err != nil {
+		logger.Error.Println(err)
+	}
+
+	// slot counters used to be unique per interval, with strata there is one counter per stratum
+	_, err = dbService.collectionRefSlotCounters(instanceID).Indexes().DropOne(ctx, "intervalStart_-1")
+	if err != nil && !isIndexNotFoundError(err) {
+		logger.Error.Println(err)
+	}
+
+	_, err = dbService.collectionRefSlotCounters(instanceID).Indexes().CreateOne(
+		ctx, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "intervalStart", Value: -1},
+				{Key: "stratum", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+	if err != nil {
+		logger.Error.Println(err)
+	}
 }
 
-func (dbService *SelfSwabbingExtDBService) LoadLatestSlotCurve(instanceID string) (res sampler.SlotCurve, err error) {
+// LoadLatestSlotCurve returns the latest version of the slot curve of the interval starting at intervalStart
+func (dbService *SelfSwabbingExtDBService) LoadLatestSlotCurve(instanceID string, intervalStart int64) (res sampler.SlotCurve, err error) {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
-	filter := bson.M{}
+	filter := bson.M{"intervalStart": intervalStart}
 	opts := options.FindOne()
-	opts.SetSort(bson.D{{Key: "intervalStart", Value: -1}})
+	opts.SetSort(bson.D{{Key: "version", Value: -1}})
 
 	if err = dbService.collectionRefSlotCurves(instanceID).FindOne(
 		ctx,
@@ -68,12 +144,60 @@ func (dbService *SelfSwabbingExtDBService) LoadLatestSlotCurve(instanceID string
 	return res, nil
 }
 
-func (dbService *SelfSwabbingExtDBService) SaveNewSlotCurve(instanceID string, obj sampler.SlotCurve) (err error) {
+// FindSlotCurveVersions returns all versions of the slot curve of an interval, newest first
+func (dbService *SelfSwabbingExtDBService) FindSlotCurveVersions(instanceID string, intervalStart int64) (res []sampler.SlotCurve, err error) {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
-	_, err = dbService.collectionRefSlotCurves(instanceID).InsertOne(ctx, obj)
-	return err
+	filter := bson.M{"intervalStart": intervalStart}
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: -1}})
+
+	cur, err := dbService.collectionRefSlotCurves(instanceID).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	res = []sampler.SlotCurve{}
+	err = cur.All(ctx, &res)
+	return res, err
+}
+
+// SaveNewSlotCurve stores the curve as the next version of its interval's curve and returns the stored curve
+func (dbService *SelfSwabbingExtDBService) SaveNewSlotCurve(instanceID string, obj sampler.SlotCurve) (res sampler.SlotCurve, err error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	for attempt := 0; attempt < 5; attempt++ {
+		var latest sampler.SlotCurve
+		err = dbService.collectionRefSlotCurves(instanceID).FindOne(
+			ctx,
+			bson.M{"intervalStart": obj.IntervalStart},
+			options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}}),
+		).Decode(&latest)
+		switch {
+		case err == nil:
+			obj.Version = latest.Version + 1
+		case errors.Is(err, mongo.ErrNoDocuments):
+			obj.Version = 1
+		default:
+			return res, err
+		}
+
+		obj.ID = primitive.NilObjectID
+		obj.CreatedAt = time.Now().Unix()
+		insertRes, err := dbService.collectionRefSlotCurves(instanceID).InsertOne(ctx, obj)
+		if mongo.IsDuplicateKeyError(err) {
+			// another version was saved concurrently
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		obj.ID = insertRes.InsertedID.(primitive.ObjectID)
+		return obj, nil
+	}
+	return res, errors.New("could not save slot curve: too many concurrent changes")
 }
 
 func (dbService *SelfSwabbingExtDBService) GetUsedSlotsCountSince(instanceID string, ref int64) (count int64, err error) {
@@ -81,44 +205,203 @@ func (dbService *SelfSwabbingExtDBService) GetUsedSlotsCountSince(instanceID str
 	defer cancel()
 
 	filter := bson.M{
-		"time": bson.M{"$gt": ref},
+		"time":   bson.M{"$gt": ref},
+		"status": bson.M{"$in": activeSlotStatuses},
 	}
 	count, err = dbService.collectionRefUsedSlots(instanceID).CountDocuments(ctx, filter)
 	return
 }
 
+// GetUsedSlotsCountPerStratumSince counts the used slots reserved after ref per stratum
+func (dbService *SelfSwabbingExtDBService) GetUsedSlotsCountPerStratumSince(instanceID string, ref int64) (counts map[string]int64, err error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{
+			"time":   bson.M{"$gt": ref},
+			"status": bson.M{"$in": activeSlotStatuses},
+		}},
+		bson.M{"$group": bson.M{
+			"_id":   "$stratum",
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+	cur, err := dbService.collectionRefUsedSlots(instanceID).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var groups []struct {
+		Stratum string `bson:"_id"`
+		Count   int64  `bson:"count"`
+	}
+	if err := cur.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	counts = make(map[string]int64, len(groups))
+	for _, g := range groups {
+		counts[g.Stratum] += g.Count
+	}
+	return counts, nil
+}
+
 type UsedSlot struct {
-	Time          int64  `bson:"time" json:"time"`
-	ParticipantID string `bson:"participantID" json:"participantID"`
-	Status        string `bson:"status" json:"status"`
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Time          int64              `bson:"time" json:"time"`
+	IntervalStart int64              `bson:"intervalStart,omitempty" json:"intervalStart,omitempty"`
+	Stratum       string             `bson:"stratum,omitempty" json:"stratum,omitempty"`
+	ParticipantID string             `bson:"participantID" json:"participantID"`
+	Status        string             `bson:"status" json:"status"`
+	ConfirmedAt   int64              `bson:"confirmedAt,omitempty" json:"confirmedAt,omitempty"`
+	CancelledAt   int64              `bson:"cancelledAt,omitempty" json:"cancelledAt,omitempty"`
+	ExpiredAt     int64              `bson:"expiredAt,omitempty" json:"expiredAt,omitempty"`
+}
+
+// SlotCounter counts the used slots of an interval, so a slot can be taken with a single atomic update
+type SlotCounter struct {
+	IntervalStart int64  `bson:"intervalStart"`
+	Stratum       string `bson:"stratum,omitempty"`
+	Used          int64  `bson:"used"`
+}
+
+// stratumFilter matches the slots or counter of a stratum, slots without stratum have no stratum field
+func stratumFilter(stratum string) interface{} {
+	if stratum == "" {
+		return nil
+	}
+	return stratum
 }
 
 const (
 	USED_SLOT_STATUS_RESERVED  = "reserved"
 	USED_SLOT_STATUS_CONFIRMED = "confirmed"
+	USED_SLOT_STATUS_CANCELLED = "cancelled"
+	USED_SLOT_STATUS_EXPIRED   = "expired"
 )
 
-func (dbService *SelfSwabbingExtDBService) ReserveSlot(instanceID string, participantID string) error {
+// activeSlotStatuses are the statuses of slots that count as used
+var activeSlotStatuses = bson.A{USED_SLOT_STATUS_RESERVED, USED_SLOT_STATUS_CONFIRMED}
+
+// ReserveSlot reserves a slot for the participant if fewer than target slots of the stratum are used in the interval.
+// If the participant already has an open reservation, it is kept and no new slot is used.
+func (dbService *SelfSwabbingExtDBService) ReserveSlot(instanceID string, participantID string, intervalStart int64, stratum string, target int) (reserved bool, err error) {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
-	var newUsedSlot UsedSlot
+	var existingSlot UsedSlot
 	filter := bson.M{
 		"participantID": participantID,
 		"status":        USED_SLOT_STATUS_RESERVED,
 	}
-	err := dbService.collectionRefUsedSlots(instanceID).FindOne(ctx, filter).Decode(&newUsedSlot)
+	err = dbService.collectionRefUsedSlots(instanceID).FindOne(ctx, filter).Decode(&existingSlot)
 	if err == nil {
-		return nil
+		return true, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return false, err
 	}
 
-	newUsedSlot = UsedSlot{
+	taken, err := dbService.takeSlot(ctx, instanceID, intervalStart, stratum, int64(target))
+	if err != nil || !taken {
+		return false, err
+	}
+
+	newUsedSlot := UsedSlot{
 		Time:          time.Now().Unix(),
+		IntervalStart: intervalStart,
+		Stratum:       stratum,
 		ParticipantID: participantID,
 		Status:        USED_SLOT_STATUS_RESERVED,
 	}
-
 	_, err = dbService.collectionRefUsedSlots(instanceID).InsertOne(ctx, newUsedSlot)
+	if err != nil {
+		if releaseErr := dbService.releaseSlot(ctx, instanceID, newUsedSlot); releaseErr != nil {
+			logger.Error.Printf("could not release slot after failed reservation: %v", releaseErr)
+		}
+		// a concurrent call reserved a slot for the participant in the meantime
+		if mongo.IsDuplicateKeyError(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// takeSlot increments the used counter of the interval if it is below target, in one atomic update
+func (dbService *SelfSwabbingExtDBService) takeSlot(ctx context.Context, instanceID string, intervalStart int64, stratum string, target int64) (bool, error) {
+	filter := bson.M{
+		"intervalStart": intervalStart,
+		"stratum":       stratumFilter(stratum),
+		"used":          bson.M{"$lt": target},
+	}
+	update := bson.M{"$inc": bson.M{"used": 1}}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		err := dbService.collectionRefSlotCounters(instanceID).FindOneAndUpdate(ctx, filter, update).Err()
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return false, err
+		}
+		// either all slots are used or the counter doesn't exist yet
+		created, err := dbService.initSlotCounter(ctx, instanceID, intervalStart, stratum)
+		if err != nil {
+			return false, err
+		}
+		if !created {
+			return false, nil
+		}
+	}
+	return false, nil
+}
+
+// initSlotCounter creates the counter of the interval from the slots already stored, returns false if it already existed
+func (dbService *SelfSwabbingExtDBService) initSlotCounter(ctx context.Context, instanceID string, intervalStart int64, stratum string) (bool, error) {
+	count, err := dbService.collectionRefUsedSlots(instanceID).CountDocuments(ctx, bson.M{
+		"time":    bson.M{"$gt": intervalStart},
+		"status":  bson.M{"$in": activeSlotStatuses},
+		"stratum": stratumFilter(stratum),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	res, err := dbService.collectionRefSlotCounters(instanceID).UpdateOne(ctx,
+		bson.M{"intervalStart": intervalStart, "stratum": stratumFilter(stratum)},
+		bson.M{"$setOnInsert": bson.M{"used": count}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// created concurrently
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return res.UpsertedCount > 0, nil
+}
+
+// releaseSlot decrements the counter of the interval the slot was reserved in
+func (dbService *SelfSwabbingExtDBService) releaseSlot(ctx context.Context, instanceID string, slot UsedSlot) error {
+	filter := bson.M{
+		"used":    bson.M{"$gt": 0},
+		"stratum": stratumFilter(slot.Stratum),
+	}
+	if slot.IntervalStart > 0 {
+		filter["intervalStart"] = slot.IntervalStart
+	} else {
+		// slots reserved before counters were introduced: use the interval containing the reservation time
+		filter["intervalStart"] = bson.M{"$lt": slot.Time}
+	}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "intervalStart", Value: -1}})
+	err := dbService.collectionRefSlotCounters(instanceID).FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"used": -1}}, opts).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
 	return err
 }
 
@@ -131,12 +414,21 @@ func (dbService *SelfSwabbingExtDBService) CancelSlotReservation(instanceID stri
 		"status":        USED_SLOT_STATUS_RESERVED,
 	}
 
+	// the slot is kept with cancelled status, so declined invitations show up in reports
+	update := bson.M{"$set": bson.M{
+		"status":      USED_SLOT_STATUS_CANCELLED,
+		"cancelledAt": time.Now().Unix(),
+	}}
+
 	var res UsedSlot
-	opts := options.FindOneAndDelete()
+	opts := options.FindOneAndUpdate()
 	opts.SetSort(bson.D{{Key: "time", Value: -1}})
-	err := dbService.collectionRefUsedSlots(instanceID).FindOneAndDelete(ctx, filter, opts).Decode(&res)
+	err := dbService.collectionRefUsedSlots(instanceID).FindOneAndUpdate(ctx, filter, update, opts).Decode(&res)
+	if err != nil {
+		return err
+	}
 
-	return err
+	return dbService.releaseSlot(ctx, instanceID, res)
 }
 
 func (dbService *SelfSwabbingExtDBService) ConfirmSlot(instanceID string, participantID string) error {
@@ -148,7 +440,10 @@ func (dbService *SelfSwabbingExtDBService) ConfirmSlot(instanceID string, partic
 		"status":        USED_SLOT_STATUS_RESERVED,
 	}
 
-	update := bson.M{"$set": bson.M{"status": USED_SLOT_STATUS_CONFIRMED}}
+	update := bson.M{"$set": bson.M{
+		"status":      USED_SLOT_STATUS_CONFIRMED,
+		"confirmedAt": time.Now().Unix(),
+	}}
 
 	var res UsedSlot
 	opts := options.FindOneAndUpdate()
@@ -158,17 +453,186 @@ func (dbService *SelfSwabbingExtDBService) ConfirmSlot(instanceID string, partic
 	return err
 }
 
-func (dbService *SelfSwabbingExtDBService) CleanUpExpiredSlotReservations(instanceID string) error {
+// GetConfirmedSlotsCountPerStratum counts the confirmed slots reserved in [from, until) per stratum, slots without stratum are counted for ""
+func (dbService *SelfSwabbingExtDBService) GetConfirmedSlotsCountPerStratum(instanceID string, from int64, until int64) (counts map[string]int64, err error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{
+			"time":   bson.M{"$gte": from, "$lt": until},
+			"status": USED_SLOT_STATUS_CONFIRMED,
+		}},
+		bson.M{"$group": bson.M{
+			"_id":   "$stratum",
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+	cur, err := dbService.collectionRefUsedSlots(instanceID).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var groups []struct {
+		Stratum string `bson:"_id"`
+		Count   int64  `bson:"count"`
+	}
+	if err := cur.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	counts = make(map[string]int64, len(groups))
+	for _, g := range groups {
+		counts[g.Stratum] += g.Count
+	}
+	return counts, nil
+}
+
+// GetParticipantSlotStats summarises the confirmed and declined slots of the participant, for the sampler's eligibility rules
+func (dbService *SelfSwabbingExtDBService) GetParticipantSlotStats(instanceID string, participantID string, seasonStart int64) (stats sampler.ParticipantSlotStats, err error) {
 	ctx, cancel := dbService.getContext()
 	defer cancel()
 
-	ref := time.Now().AddDate(0, 0, -7).Unix()
 	filter := bson.M{
-		"$and": bson.A{
-			bson.M{"time": bson.M{"$lt": ref}},
-			bson.M{"status": USED_SLOT_STATUS_RESERVED},
-		},
+		"participantID": participantID,
+		"status":        bson.M{"$in": bson.A{USED_SLOT_STATUS_CONFIRMED, USED_SLOT_STATUS_CANCELLED}},
+	}
+	cur, err := dbService.collectionRefUsedSlots(instanceID).Find(ctx, filter)
+	if err != nil {
+		return stats, err
+	}
+	defer cur.Close(ctx)
+
+	slots := []UsedSlot{}
+	if err := cur.All(ctx, &slots); err != nil {
+		return stats, err
 	}
-	_, err := dbService.collectionRefUsedSlots(instanceID).DeleteMany(ctx, filter)
+
+	for _, slot := range slots {
+		switch slot.Status {
+		case USED_SLOT_STATUS_CONFIRMED:
+			// slots confirmed before confirmedAt was stored only have the reservation time
+			confirmedAt := slot.ConfirmedAt
+			if confirmedAt == 0 {
+				confirmedAt = slot.Time
+			}
+			if confirmedAt > stats.LastConfirmedAt {
+				stats.LastConfirmedAt = confirmedAt
+			}
+			if confirmedAt >= seasonStart {
+				stats.ConfirmedInSeason += 1
+			}
+		case USED_SLOT_STATUS_CANCELLED:
+			stats.Declines += 1
+		}
+	}
+	return stats, nil
+}
+
+// ExpireSlotReservations marks reservations older than ttl as expired and releases their slots.
+// Returns the number of expired reservations.
+func (dbService *SelfSwabbingExtDBService) ExpireSlotReservations(instanceID string, ttl time.Duration) (int, error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"time":   bson.M{"$lt": now.Add(-ttl).Unix()},
+		"status": USED_SLOT_STATUS_RESERVED,
+	}
+	cur, err := dbService.collectionRefUsedSlots(instanceID).Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	expiredSlots := []UsedSlot{}
+	if err := cur.All(ctx, &expiredSlots); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, slot := range expiredSlots {
+		// the slot is kept with expired status, so unanswered invitations show up in reports
+		res, err := dbService.collectionRefUsedSlots(instanceID).UpdateOne(ctx, bson.M{
+			"_id":    slot.ID,
+			"status": USED_SLOT_STATUS_RESERVED,
+		}, bson.M{"$set": bson.M{
+			"status":    USED_SLOT_STATUS_EXPIRED,
+			"expiredAt": now.Unix(),
+		}})
+		if err != nil {
+			return count, err
+		}
+		if res.ModifiedCount < 1 {
+			// confirmed, cancelled or expired by another instance in the meantime
+			continue
+		}
+		if err := dbService.releaseSlot(ctx, instanceID, slot); err != nil {
+			return count, err
+		}
+		count += 1
+	}
+	return count, nil
+}
+
+// SaveArrival records an /is-selected call
+func (dbService *SelfSwabbingExtDBService) SaveArrival(instanceID string, arrival sampler.RecordedArrival) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	_, err := dbService.collectionRefArrivals(instanceID).InsertOne(ctx, arrival)
+	return err
+}
+
+// FindArrivalTimes returns the times of all recorded /is-selected calls in [from, until)
+func (dbService *SelfSwabbingExtDBService) FindArrivalTimes(instanceID string, from int64, until int64) (times []int64, err error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	filter := bson.M{"time": bson.M{"$gte": from, "$lt": until}}
+	opts := options.Find().SetProjection(bson.M{"time": 1})
+	cur, err := dbService.collectionRefArrivals(instanceID).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var arrivals []sampler.RecordedArrival
+	if err := cur.All(ctx, &arrivals); err != nil {
+		return nil, err
+	}
+	times = make([]int64, len(arrivals))
+	for i, a := range arrivals {
+		times[i] = a.Time
+	}
+	return times, nil
+}
+
+// samplerStateID is the _id of the only document in the sampler-state collection
+const samplerStateID = "state"
+
+// LoadSamplerState returns the state set by an admin, an empty state if it was never set
+func (dbService *SelfSwabbingExtDBService) LoadSamplerState(instanceID string) (state sampler.SamplerState, err error) {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	err = dbService.collectionRefSamplerState(instanceID).FindOne(ctx, bson.M{"_id": samplerStateID}).Decode(&state)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return state, nil
+	}
+	return state, err
+}
+
+func (dbService *SelfSwabbingExtDBService) SaveSamplerState(instanceID string, state sampler.SamplerState) error {
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+
+	_, err := dbService.collectionRefSamplerState(instanceID).ReplaceOne(ctx,
+		bson.M{"_id": samplerStateID},
+		state,
+		options.Replace().SetUpsert(true),
+	)
 	return err
 }
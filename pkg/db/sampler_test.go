@@ -0,0 +1,277 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/entrycodes"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/sampler"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const ENV_TEST_DB_URI = "SELF_SWABBING_EXT_TEST_DB_URI"
+
+// testDBService connects to the MongoDB given in SELF_SWABBING_EXT_TEST_DB_URI and uses a fresh instance DB per test
+func testDBService(t *testing.T) (*SelfSwabbingExtDBService, string) {
+	uri := os.Getenv(ENV_TEST_DB_URI)
+	if uri == "" {
+		t.Skipf("%s not set, skipping DB test", ENV_TEST_DB_URI)
+	}
+
+	dbService := NewSelfSwabbingExtDBService(types.DBConfig{
+		URI:             uri,
+		DBNamePrefix:    "test_",
+		Timeout:         10,
+		MaxPoolSize:     100,
+		IdleConnTimeout: 30,
+	}, entrycodes.NewHasher(""))
+
+	instanceID := fmt.Sprintf("%s%d", t.Name(), time.Now().UnixNano())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := dbService.collectionRefUsedSlots(instanceID).Database().Drop(ctx); err != nil {
+			t.Logf("could not drop test DB: %v", err)
+		}
+	})
+	dbService.CreateIndexesForSampler(instanceID)
+	return dbService, instanceID
+}
+
+func newTestSampler(dbService *SelfSwabbingExtDBService, instanceID string, target int) *sampler.Sampler {
+	s := sampler.NewSampler(instanceID, dbService, sampler.DefaultIntervalConfig())
+	s.SetCurve(sampler.SlotCurve{
+		IntervalStart: time.Now().Add(-time.Hour).Unix(),
+		OpenSlots:     []sampler.OpenSlots{{T: 0, Value: target}},
+	})
+	return s
+}
+
+func TestTryReserveSlotConcurrently(t *testing.T) {
+	dbService, instanceID := testDBService(t)
+
+	target := 10
+	s := newTestSampler(dbService, instanceID, target)
+
+	n := 100
+	var reserved atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ok, err := s.TryReserveSlot(fmt.Sprintf("participant-%d", i), "")
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if ok {
+				reserved.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if int(reserved.Load()) != target {
+		t.Errorf("%d slots reserved, expected %d", reserved.Load(), target)
+	}
+	count, err := dbService.GetUsedSlotsCountSince(instanceID, s.Curve().IntervalStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(count) != target {
+		t.Errorf("%d used slots stored, expected %d", count, target)
+	}
+}
+
+func TestTryReserveSlotConcurrentlyForSameParticipant(t *testing.T) {
+	dbService, instanceID := testDBService(t)
+
+	target := 10
+	s := newTestSampler(dbService, instanceID, target)
+
+	n := 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := s.TryReserveSlot("participant-1", "")
+			if err != nil || !ok {
+				t.Errorf("reservation failed: %t, %v", ok, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	count, err := dbService.GetUsedSlotsCountSince(instanceID, s.Curve().IntervalStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("%d used slots stored, expected 1", count)
+	}
+	// the counter must only include the one reservation
+	for i := 1; i < target; i++ {
+		if ok, err := s.TryReserveSlot(fmt.Sprintf("participant-%d", i+1), ""); err != nil || !ok {
+			t.Fatalf("reservation %d failed: %t, %v", i+1, ok, err)
+		}
+	}
+}
+
+func TestCancelSlotReservationReleasesSlot(t *testing.T) {
+	dbService, instanceID := testDBService(t)
+
+	s := newTestSampler(dbService, instanceID, 1)
+
+	if ok, err := s.TryReserveSlot("participant-1", ""); err != nil || !ok {
+		t.Fatalf("first reservation failed: %t, %v", ok, err)
+	}
+	if ok, err := s.TryReserveSlot("participant-2", ""); err != nil || ok {
+		t.Fatalf("reservation should fail when all slots are used: %t, %v", ok, err)
+	}
+	if err := dbService.CancelSlotReservation(instanceID, "participant-1"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.TryReserveSlot("participant-2", ""); err != nil || !ok {
+		t.Fatalf("reservation should succeed after cancellation: %t, %v", ok, err)
+	}
+}
+
+func TestExpireSlotReservationsReleasesSlot(t *testing.T) {
+	dbService, instanceID := testDBService(t)
+
+	s := newTestSampler(dbService, instanceID, 1)
+
+	if ok, err := s.TryReserveSlot("participant-1", ""); err != nil || !ok {
+		t.Fatalf("first reservation failed: %t, %v", ok, err)
+	}
+	if n, err := dbService.ExpireSlotReservations(instanceID, 10*time.Minute); err != nil || n != 0 {
+		t.Fatalf("new reservation should not expire: %d, %v", n, err)
+	}
+
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+	_, err := dbService.collectionRefUsedSlots(instanceID).UpdateOne(ctx,
+		bson.M{"participantID": "participant-1"},
+		bson.M{"$set": bson.M{"time": time.Now().Add(-30 * time.Minute).Unix()}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := dbService.ExpireSlotReservations(instanceID, 10*time.Minute); err != nil || n != 1 {
+		t.Fatalf("old reservation should expire: %d, %v", n, err)
+	}
+
+	var slot UsedSlot
+	if err := dbService.collectionRefUsedSlots(instanceID).FindOne(ctx, bson.M{"participantID": "participant-1"}).Decode(&slot); err != nil {
+		t.Fatal(err)
+	}
+	if slot.Status != USED_SLOT_STATUS_EXPIRED || slot.ExpiredAt == 0 {
+		t.Errorf("expired reservation should be kept with expired status: %+v", slot)
+	}
+	if ok, err := s.TryReserveSlot("participant-2", ""); err != nil || !ok {
+		t.Fatalf("reservation should succeed after expiry: %t, %v", ok, err)
+	}
+}
+
+func TestTryReserveSlotPerStratum(t *testing.T) {
+	dbService, instanceID := testDBService(t)
+
+	s := sampler.NewSampler(instanceID, dbService, sampler.DefaultIntervalConfig())
+	s.SetCurve(sampler.SlotCurve{
+		IntervalStart: time.Now().Add(-time.Hour).Unix(),
+		OpenSlots:     []sampler.OpenSlots{{T: 0, Value: 3}},
+		Strata: []sampler.StratumCurve{
+			{Key: "young", OpenSlots: []sampler.OpenSlots{{T: 0, Value: 1}}},
+			{Key: "old", OpenSlots: []sampler.OpenSlots{{T: 0, Value: 2}}},
+		},
+	})
+
+	if ok, err := s.TryReserveSlot("participant-1", "young"); err != nil || !ok {
+		t.Fatalf("first reservation of stratum failed: %t, %v", ok, err)
+	}
+	if ok, err := s.TryReserveSlot("participant-2", "young"); err != nil || ok {
+		t.Fatalf("reservation should fail when all slots of the stratum are used: %t, %v", ok, err)
+	}
+	if ok, err := s.TryReserveSlot("participant-3", "old"); err != nil || !ok {
+		t.Fatalf("other stratum should still have free slots: %t, %v", ok, err)
+	}
+	if _, err := s.TryReserveSlot("participant-4", "unknown"); !errors.Is(err, sampler.ErrUnknownStratum) {
+		t.Fatalf("expected unknown stratum error, got %v", err)
+	}
+
+	counts, err := dbService.GetUsedSlotsCountPerStratumSince(instanceID, s.Curve().IntervalStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["young"] != 1 || counts["old"] != 1 {
+		t.Errorf("unexpected used slots per stratum: %v", counts)
+	}
+}
+
+func TestFindArrivalTimes(t *testing.T) {
+	dbService, instanceID := testDBService(t)
+
+	for _, ts := range []int64{100, 200, 300} {
+		if err := dbService.SaveArrival(instanceID, sampler.RecordedArrival{Time: ts, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	times, err := dbService.FindArrivalTimes(instanceID, 200, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 1 || times[0] != 200 {
+		t.Errorf("expected only the arrival at 200, got %v", times)
+	}
+}
+
+func TestGetSamplerReportCountsAllReservations(t *testing.T) {
+	dbService, instanceID := testDBService(t)
+
+	intervalStart := time.Now().Add(-2 * time.Hour).Unix()
+	intervalEnd := time.Now().Add(time.Hour).Unix()
+	if _, err := dbService.SaveNewSlotCurve(instanceID, sampler.SlotCurve{
+		IntervalStart: intervalStart,
+		IntervalEnd:   intervalEnd,
+		OpenSlots:     []sampler.OpenSlots{{T: 0, Value: 10}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := dbService.getContext()
+	defer cancel()
+	slots := []interface{}{
+		UsedSlot{Time: intervalStart + 10, ParticipantID: "p1", Status: USED_SLOT_STATUS_RESERVED},
+		UsedSlot{Time: intervalStart + 20, ParticipantID: "p2", Status: USED_SLOT_STATUS_CONFIRMED},
+		UsedSlot{Time: intervalStart + 30, ParticipantID: "p3", Status: USED_SLOT_STATUS_CANCELLED, CancelledAt: intervalStart + 40},
+		UsedSlot{Time: intervalStart + 40, ParticipantID: "p4", Status: USED_SLOT_STATUS_EXPIRED, ExpiredAt: intervalStart + 50},
+		UsedSlot{Time: intervalStart + 50, ParticipantID: "p5", Status: USED_SLOT_STATUS_EXPIRED, ExpiredAt: intervalStart + 60},
+		// stored before reservations had a status
+		bson.M{"time": intervalStart + 60, "participantID": "p6"},
+	}
+	if _, err := dbService.collectionRefUsedSlots(instanceID).InsertMany(ctx, slots); err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := dbService.GetSamplerReport(instanceID, sampler.DefaultIntervalConfig(), intervalStart, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("expected one interval, got %d", len(reports))
+	}
+	r := reports[0]
+	if r.Reservations != 6 || r.Reserved != 1 || r.Confirmed != 1 || r.Cancelled != 1 || r.Expired != 2 {
+		t.Errorf("unexpected counts: %+v", r)
+	}
+}
@@ -0,0 +1,120 @@
+package entrycodes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// DefaultAlphabet contains digits and upper case letters without the easily confused 0, 1, I and O
+	DefaultAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+	groupSeparator = "-"
+)
+
+var ErrInvalidCheckDigit = errors.New("invalid check digit")
+
+// Format describes how entry codes are generated and which codes are accepted
+type Format struct {
+	Alphabet   string // characters a code is built from
+	Length     int    // number of characters of a generated code, including the check digit
+	GroupSize  int    // when printing, a separator is inserted after every GroupSize characters (0: no grouping)
+	CheckDigit bool   // codes end with a Luhn mod N check digit, codes with a wrong check digit are rejected
+}
+
+func (f Format) Validate() error {
+	if len(f.Alphabet) < 2 {
+		return errors.New("alphabet must contain at least two characters")
+	}
+	seen := map[rune]bool{}
+	for _, r := range f.Alphabet {
+		if r > 127 {
+			return fmt.Errorf("alphabet must only contain ASCII characters, found '%c'", r)
+		}
+		if strings.ContainsRune(" _"+groupSeparator, r) {
+			return fmt.Errorf("alphabet must not contain separator character '%c'", r)
+		}
+		if seen[r] {
+			return fmt.Errorf("alphabet contains '%c' more than once", r)
+		}
+		seen[r] = true
+	}
+	minLength := 1
+	if f.CheckDigit {
+		// the Luhn mod N doubling step only maps every character to a distinct value for even N
+		if len(f.Alphabet)%2 != 0 {
+			return errors.New("alphabet must contain an even number of characters when check digits are enabled")
+		}
+		minLength = 2
+	}
+	if f.Length < minLength {
+		return fmt.Errorf("code length must be at least %d", minLength)
+	}
+	if f.GroupSize < 0 {
+		return errors.New("group size must not be negative")
+	}
+	return nil
+}
+
+// Normalize converts the code to upper case, if the alphabet does not contain lower case characters
+func (f Format) Normalize(code string) string {
+	if strings.ToUpper(f.Alphabet) == f.Alphabet {
+		return strings.ToUpper(code)
+	}
+	return code
+}
+
+// Check verifies that an already sanitized code only uses the alphabet and, if enabled, carries a correct check digit
+func (f Format) Check(code string) error {
+	if !f.CheckDigit {
+		return nil
+	}
+	for _, r := range code {
+		if !strings.ContainsRune(f.Alphabet, r) {
+			return fmt.Errorf("unexpected character '%c'", r)
+		}
+	}
+	if len(code) < 2 || !luhnModNValid(f.Alphabet, code) {
+		return ErrInvalidCheckDigit
+	}
+	return nil
+}
+
+// Group inserts separators into the code for better readability on printed material
+func (f Format) Group(code string) string {
+	if f.GroupSize < 1 || len(code) <= f.GroupSize {
+		return code
+	}
+	parts := []string{}
+	for i := 0; i < len(code); i += f.GroupSize {
+		end := min(i+f.GroupSize, len(code))
+		parts = append(parts, code[i:end])
+	}
+	return strings.Join(parts, groupSeparator)
+}
+
+// luhnModNCheckChar computes the check character for the input based on the Luhn mod N algorithm
+func luhnModNCheckChar(alphabet string, input string) byte {
+	n := len(alphabet)
+	factor := 2
+	sum := 0
+	for i := len(input) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(alphabet, input[i])
+		factor = 3 - factor
+		sum += addend/n + addend%n
+	}
+	return alphabet[(n-sum%n)%n]
+}
+
+func luhnModNValid(alphabet string, input string) bool {
+	n := len(alphabet)
+	factor := 1
+	sum := 0
+	for i := len(input) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(alphabet, input[i])
+		factor = 3 - factor
+		sum += addend/n + addend%n
+	}
+	return sum%n == 0
+}
@@ -0,0 +1,153 @@
+package entrycodes
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testFormat() Format {
+	return Format{Alphabet: DefaultAlphabet, Length: 10, GroupSize: 5, CheckDigit: true}
+}
+
+func TestFormatValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  Format
+		wantErr bool
+	}{
+		{"default", testFormat(), false},
+		{"without check digit", Format{Alphabet: "0123456789", Length: 6}, false},
+		{"odd alphabet without check digit", Format{Alphabet: "ABC", Length: 6}, false},
+		{"alphabet too short", Format{Alphabet: "A", Length: 6}, true},
+		{"non-ASCII alphabet", Format{Alphabet: "ABCÄ", Length: 6}, true},
+		{"separator in alphabet", Format{Alphabet: "AB-C", Length: 6}, true},
+		{"duplicate character", Format{Alphabet: "ABCA", Length: 6}, true},
+		{"odd alphabet with check digit", Format{Alphabet: "ABC", Length: 6, CheckDigit: true}, true},
+		{"only the check digit", Format{Alphabet: DefaultAlphabet, Length: 1, CheckDigit: true}, true},
+		{"empty code", Format{Alphabet: DefaultAlphabet, Length: 0}, true},
+		{"negative group size", Format{Alphabet: DefaultAlphabet, Length: 6, GroupSize: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.format.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error: %t, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestGeneratedCodesAreValid(t *testing.T) {
+	f := testFormat()
+	codes, err := f.Generate(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range codes {
+		if len(code) != f.Length {
+			t.Errorf("%s: expected length %d", code, f.Length)
+		}
+		if err := f.Check(code); err != nil {
+			t.Errorf("%s: %v", code, err)
+		}
+	}
+}
+
+func TestCheckDetectsSingleSubstitutions(t *testing.T) {
+	f := testFormat()
+	codes, err := f.Generate(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range codes {
+		for i := range code {
+			for _, r := range f.Alphabet {
+				if byte(r) == code[i] {
+					continue
+				}
+				changed := code[:i] + string(r) + code[i+1:]
+				if err := f.Check(changed); !errors.Is(err, ErrInvalidCheckDigit) {
+					t.Fatalf("%s -> %s: expected ErrInvalidCheckDigit, got %v", code, changed, err)
+				}
+			}
+		}
+	}
+}
+
+func TestCheckDetectsAdjacentTranspositions(t *testing.T) {
+	f := testFormat()
+	a := f.Alphabet
+	last := len(a) - 1
+	for _, prefix := range []string{"", "K", "KM"} {
+		for i := range a {
+			for j := range a {
+				// like 09 <-> 90 in the decimal Luhn algorithm, swapping the first and the last character isn't detected
+				if i == j || (i == 0 && j == last) || (i == last && j == 0) {
+					continue
+				}
+				payload := prefix + string(a[i]) + string(a[j]) + "XY"
+				code := payload + string(luhnModNCheckChar(a, payload))
+				if err := f.Check(code); err != nil {
+					t.Fatalf("%s: %v", code, err)
+				}
+				swapped := prefix + string(a[j]) + string(a[i]) + code[len(prefix)+2:]
+				if err := f.Check(swapped); !errors.Is(err, ErrInvalidCheckDigit) {
+					t.Errorf("%s -> %s: expected ErrInvalidCheckDigit, got %v", code, swapped, err)
+				}
+			}
+		}
+	}
+}
+
+func TestCheckRejectsCharactersOutsideOfTheAlphabet(t *testing.T) {
+	f := testFormat()
+	code := "2345678" + "9A"
+	code += string(luhnModNCheckChar(f.Alphabet, code))
+	if err := f.Check(code); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, wrong := range []string{"0", "1", "I", "O", "a"} {
+		changed := wrong + code[1:]
+		err := f.Check(changed)
+		if err == nil || errors.Is(err, ErrInvalidCheckDigit) {
+			t.Errorf("%s: expected an unexpected character error, got %v", changed, err)
+		}
+	}
+	if err := f.Check(strings.ToLower(code)); err == nil {
+		t.Error("expected lower case code to be rejected before normalizing")
+	}
+	if err := f.Check(f.Normalize(strings.ToLower(code))); err != nil {
+		t.Errorf("expected normalized code to be valid, got %v", err)
+	}
+
+	noCheckDigit := Format{Alphabet: DefaultAlphabet, Length: 10}
+	if err := noCheckDigit.Check("anything-goes"); err != nil {
+		t.Errorf("expected no check without check digit, got %v", err)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	tests := []struct {
+		groupSize int
+		code      string
+		want      string
+	}{
+		{5, "ABCDEFGHJK", "ABCDE-FGHJK"},
+		{3, "ABCDEFGHJK", "ABC-DEF-GHJ-K"},
+		{0, "ABCDEFGHJK", "ABCDEFGHJK"},
+		{10, "ABCDEFGHJK", "ABCDEFGHJK"},
+		{12, "ABCDEFGHJK", "ABCDEFGHJK"},
+	}
+	for _, tt := range tests {
+		f := Format{Alphabet: DefaultAlphabet, Length: len(tt.code), GroupSize: tt.groupSize}
+		got := f.Group(tt.code)
+		if got != tt.want {
+			t.Errorf("group size %d: expected %s, got %s", tt.groupSize, tt.want, got)
+		}
+		if ungrouped := strings.ReplaceAll(got, groupSeparator, ""); ungrouped != tt.code {
+			t.Errorf("group size %d: removing the separators gives %s", tt.groupSize, ungrouped)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package entrycodes
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+)
+
+// maxGenerateRounds limits how often codes rejected as duplicates are replaced by GenerateAndSave
+const maxGenerateRounds = 10
+
+// ErrCodeSpaceTooSmall is returned when more codes are requested than the format can produce
+var ErrCodeSpaceTooSmall = errors.New("not enough distinct codes available, consider increasing the code length")
+
+// Generate creates n distinct random codes using a cryptographically secure random source
+func (f Format) Generate(n int) ([]string, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return f.generateDistinct(n, map[string]bool{})
+}
+
+// GenerateAndSave creates n new codes and stores them with save, which returns the codes it rejected as
+// already existing. Rejected codes are replaced with new ones, so the result only contains codes that were saved.
+func (f Format) GenerateAndSave(n int, save func(codes []string) (duplicates map[string]bool, err error)) ([]string, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	// seen also holds the rejected codes, so they are not generated again
+	seen := make(map[string]bool, n)
+	saved := make([]string, 0, n)
+	for round := 0; len(saved) < n; round++ {
+		if round >= maxGenerateRounds {
+			return saved, errors.New("could not generate unique codes, consider increasing the code length")
+		}
+		codes, err := f.generateDistinct(n-len(saved), seen)
+		if err != nil {
+			return saved, err
+		}
+		duplicates, err := save(codes)
+		if err != nil {
+			return saved, err
+		}
+		for _, code := range codes {
+			if !duplicates[code] {
+				saved = append(saved, code)
+			}
+		}
+	}
+	return saved, nil
+}
+
+// generateDistinct creates n random codes that are not in seen and adds them to seen
+func (f Format) generateDistinct(n int, seen map[string]bool) ([]string, error) {
+	if !f.hasCodeSpace(len(seen) + n) {
+		return nil, ErrCodeSpaceTooSmall
+	}
+
+	codes := make([]string, 0, n)
+	for len(codes) < n {
+		code, err := f.generateOne()
+		if err != nil {
+			return nil, err
+		}
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// hasCodeSpace reports whether the format allows at least n distinct codes
+func (f Format) hasCodeSpace(n int) bool {
+	space := 1
+	for i := 0; i < f.payloadLength() && space < n; i++ {
+		space *= len(f.Alphabet)
+	}
+	return space >= n
+}
+
+// payloadLength is the number of random characters of a code
+func (f Format) payloadLength() int {
+	if f.CheckDigit {
+		return f.Length - 1
+	}
+	return f.Length
+}
+
+func (f Format) generateOne() (string, error) {
+	max := big.NewInt(int64(len(f.Alphabet)))
+	code := make([]byte, f.payloadLength(), f.Length)
+	for i := range code {
+		v, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = f.Alphabet[v.Int64()]
+	}
+	if f.CheckDigit {
+		code = append(code, luhnModNCheckChar(f.Alphabet, string(code)))
+	}
+	return string(code), nil
+}
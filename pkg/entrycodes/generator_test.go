@@ -0,0 +1,93 @@
+package entrycodes
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGenerateTinyCodeSpace(t *testing.T) {
+	// one random character out of 32 and a check digit
+	f := Format{Alphabet: DefaultAlphabet, Length: 2, CheckDigit: true}
+
+	codes, err := f.Generate(len(DefaultAlphabet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if seen[code] {
+			t.Errorf("duplicate code %s", code)
+		}
+		seen[code] = true
+	}
+
+	if _, err := f.Generate(len(DefaultAlphabet) + 1); !errors.Is(err, ErrCodeSpaceTooSmall) {
+		t.Errorf("expected ErrCodeSpaceTooSmall, got %v", err)
+	}
+}
+
+func TestGenerateAndSaveReplacesDuplicates(t *testing.T) {
+	f := testFormat()
+	stored := map[string]bool{}
+	calls := 0
+	codes, err := f.GenerateAndSave(10, func(codes []string) (map[string]bool, error) {
+		calls++
+		duplicates := map[string]bool{}
+		for i, code := range codes {
+			// reject every second code of the first batch as already existing
+			if calls == 1 && i%2 == 0 {
+				duplicates[code] = true
+				continue
+			}
+			stored[code] = true
+		}
+		return duplicates, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls of save, got %d", calls)
+	}
+	if len(codes) != 10 || len(stored) != 10 {
+		t.Fatalf("expected 10 saved codes, got %d (%d stored)", len(codes), len(stored))
+	}
+	for _, code := range codes {
+		if !stored[code] {
+			t.Errorf("%s returned but not stored", code)
+		}
+	}
+}
+
+func TestGenerateAndSaveGivesUp(t *testing.T) {
+	f := testFormat()
+	calls := 0
+	codes, err := f.GenerateAndSave(3, func(codes []string) (map[string]bool, error) {
+		calls++
+		duplicates := map[string]bool{}
+		for _, code := range codes {
+			duplicates[code] = true
+		}
+		return duplicates, nil
+	})
+	if err == nil {
+		t.Fatal("expected error when every code is rejected")
+	}
+	if len(codes) != 0 {
+		t.Errorf("expected no saved codes, got %d", len(codes))
+	}
+	if calls != maxGenerateRounds {
+		t.Errorf("expected %d calls of save, got %d", maxGenerateRounds, calls)
+	}
+}
+
+func TestGenerateAndSaveStopsOnError(t *testing.T) {
+	f := testFormat()
+	saveErr := errors.New("db down")
+	_, err := f.GenerateAndSave(3, func(codes []string) (map[string]bool, error) {
+		return nil, saveErr
+	})
+	if !errors.Is(err, saveErr) {
+		t.Errorf("expected save error, got %v", err)
+	}
+}
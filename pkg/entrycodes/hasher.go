@@ -0,0 +1,31 @@
+package entrycodes
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Hasher computes the keyed hash under which entry codes are stored, so the codes can't be read from the DB
+type Hasher struct {
+	secret []byte
+}
+
+// NewHasher creates a hasher using HMAC-SHA256 with the secret, with an empty secret codes are stored in plain text
+func NewHasher(secret string) Hasher {
+	return Hasher{secret: []byte(secret)}
+}
+
+func (h Hasher) Enabled() bool {
+	return len(h.secret) > 0
+}
+
+// Hash returns the hex encoded HMAC of the (sanitized) code, or the code itself if hashing is disabled
+func (h Hasher) Hash(code string) string {
+	if !h.Enabled() {
+		return code
+	}
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -1,8 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
-	"math/rand"
+	"io"
 	"net/http"
 	"time"
 
@@ -10,21 +11,11 @@ import (
 	"github.com/coneno/logger"
 	"github.com/gin-gonic/gin"
 	mw "github.com/infectieradar-nl/self-swabbing-extension/pkg/http/middlewares"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/ratelimit"
 	"github.com/infectieradar-nl/self-swabbing-extension/pkg/types"
 	"github.com/infectieradar-nl/self-swabbing-extension/pkg/utils"
 )
 
-const (
-	wrongCodeAttemptLimit                    = 10
-	wrongCodeAttemptLimitWindowResetInterval = 5 * 60
-	randomDelayMax                           = 10
-)
-
-var (
-	wrongCodeChecksPerUID map[string]int
-	lastReset             int64
-)
-
 func (h *HttpEndpoints) AddCodeCheckerAPI(rg *gin.RouterGroup) {
 	codeCheckGroup := rg.Group("/entry-codes/:instanceID")
 	codeCheckGroup.Use(mw.HasValidInstanceID())
@@ -34,7 +25,7 @@ func (h *HttpEndpoints) AddCodeCheckerAPI(rg *gin.RouterGroup) {
 			codeCheckGroup.POST("", mw.RequirePayload(), h.addNewEntryCodesHandl)
 		}
 		codeCheckGroup.POST("/is-study-full", h.isStudyFullEventHandl)
-		codeCheckGroup.GET("/is-valid", h.validateEntryCodeHandl)
+		codeCheckGroup.GET("/is-valid", mw.LimitConcurrentRequests(h.codeCheckResponse.MaxConcurrent), h.validateEntryCodeHandl)
 		codeCheckGroup.POST("/submit", mw.RequirePayload(), h.studyEventWithEntryCodeHandl)
 	}
 
@@ -43,90 +34,144 @@ func (h *HttpEndpoints) AddCodeCheckerAPI(rg *gin.RouterGroup) {
 func (h *HttpEndpoints) addNewEntryCodesHandl(c *gin.Context) {
 	instanceID := c.Param("instanceID")
 
-	var req types.NewCodeList
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	dryRun := c.DefaultQuery("dryRun", "false") == "true"
+	includeInserted := c.DefaultQuery("includeInserted", "true") == "true"
+
+	if !dryRun {
+		err := h.dbService.CreateIndexForEntryCodes(instanceID)
+		if err != nil {
+			logger.Error.Printf("unexpected error when creating index: %v", err)
+		}
 	}
 
-	err := h.dbService.CreateIndexForEntryCodes(instanceID)
-	if err != nil {
-		logger.Error.Printf("unexpected error when creating index: %v", err)
+	upload := newEntryCodeUpload(instanceID, h.entryCodeFormat, h.dbService, dryRun, includeInserted)
+
+	if c.ContentType() == "multipart/form-data" {
+		if err := h.addEntryCodesFromMultipart(c, upload); err != nil {
+			logger.Error.Printf("entry code file upload failed after %d codes: %v", upload.report.Total, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "report": upload.report})
+			return
+		}
+	} else {
+		var req types.NewCodeList
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		items := make([]entryCodeUploadItem, len(req.Codes))
+		for i, code := range req.Codes {
+			items[i] = entryCodeUploadItem{code: code, batchInfo: req.CodeBatchInfo}
+		}
+		if err := upload.addChunk(items); err != nil {
+			logger.Error.Printf("unexpected error when saving entry codes: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save entry codes"})
+			return
+		}
 	}
 
-	counter := 0
-	for _, c := range req.Codes {
-		_, err := h.dbService.AddEntryCode(instanceID, c)
+	report := upload.report
+	logger.Info.Printf("entry code upload (dry-run: %t): %d / %d codes inserted, %d duplicates, %d invalid, %d empty", report.DryRun, report.Inserted, report.Total, report.Duplicates, report.Invalid, report.Empty)
+	c.JSON(http.StatusOK, report)
+}
+
+// addEntryCodesFromMultipart streams the CSV in the "file" part, column mapping and batch metadata are read from the query
+func (h *HttpEndpoints) addEntryCodesFromMultipart(c *gin.Context, upload *entryCodeUpload) error {
+	mapping := entryCodeCSVMapping{
+		code:      c.DefaultQuery("codeColumn", "code"),
+		batchID:   c.Query("batchIDColumn"),
+		label:     c.Query("labelColumn"),
+		expiresAt: c.Query("expiresAtColumn"),
+	}
+
+	defaults := types.CodeBatchInfo{
+		BatchID: c.Query("batchID"),
+		Label:   c.Query("label"),
+	}
+	if v := c.Query("expiresAt"); v != "" {
+		expiresAt, err := parseExpiresAt(v)
 		if err != nil {
-			logger.Error.Printf("unexpected error when saving entry code '%s': %v", c, err)
-		} else {
-			counter += 1
+			return err
 		}
+		defaults.ExpiresAt = expiresAt
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%d / %d codes saved", counter, len(req.Codes))})
+	delimiter := []rune(c.DefaultQuery("delimiter", ","))
+	if len(delimiter) != 1 {
+		return errors.New("delimiter must be a single character")
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return errors.New("multipart payload has no \"file\" part")
+		}
+		if err != nil {
+			return err
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		defer part.Close()
+		return upload.addFromCSV(part, delimiter[0], mapping, defaults)
+	}
 }
 
 func (h *HttpEndpoints) validateEntryCodeHandl(c *gin.Context) {
+	start := time.Now()
 	instanceID := c.Param("instanceID")
 
 	uid := c.DefaultQuery("uid", "")
 	if uid == "" || len(uid) != 24 {
 		logger.Warning.Println("empty uid when checking entry code")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong id"})
-		time.Sleep(time.Duration(rand.Intn(randomDelayMax)) * time.Second)
+		h.writeDelayedCodeCheckResponse(c, start, http.StatusBadRequest, gin.H{"error": "wrong id"})
 		return
 	}
 
 	code := c.DefaultQuery("code", "")
-	code = SanitizeCode(code)
-	if code == "" {
+	code, codeErr := SanitizeCode(code, h.entryCodeFormat)
+	if code == "" && codeErr == nil {
 		logger.Warning.Println("empty entry code attempt")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "empty entry code attempt"})
-		time.Sleep(time.Duration(rand.Intn(randomDelayMax)) * time.Second)
+		h.writeDelayedCodeCheckResponse(c, start, http.StatusBadRequest, gin.H{"error": "empty entry code attempt"})
 		return
 	}
 
-	now := time.Now().Unix()
-	if now-lastReset > wrongCodeAttemptLimitWindowResetInterval {
-		wrongCodeChecksPerUID = map[string]int{}
-		lastReset = now
+	limiterKeys := h.codeAttemptLimiterKeys(uid, c.ClientIP())
+	if retryAfter := h.codeAttemptRetryAfter(limiterKeys); retryAfter > 0 {
+		logger.Warning.Printf("%s too many wrong code attempts, locked for %s", uid, retryAfter.Round(time.Second))
+		h.writeDelayedCodeCheckResponse(c, start, http.StatusBadRequest, gin.H{"error": "wrong entry code"})
+		return
 	}
 
-	count, ok := wrongCodeChecksPerUID[uid]
-	if ok && count > wrongCodeAttemptLimit {
-		logger.Warning.Printf("%s too many wrong code attempts", uid)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong entry code"})
-		time.Sleep(time.Duration(rand.Intn(randomDelayMax)) * time.Second)
+	if codeErr != nil {
+		h.registerWrongCodeAttempt(limiterKeys)
+		logger.Warning.Printf("entry code attempt with wrong format: %v", codeErr)
+		h.writeDelayedCodeCheckResponse(c, start, http.StatusBadRequest, gin.H{"error": "wrong entry code"})
 		return
 	}
 
 	codeInfos, err := h.dbService.FindEntryCodeInfo(instanceID, code)
 	if err != nil {
-		if !ok {
-			wrongCodeChecksPerUID[uid] = 1
-		} else {
-			wrongCodeChecksPerUID[uid] += 1
-		}
-		logger.Error.Printf("error when looking up code infos for '%s': %v", code, err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong entry code"})
-		time.Sleep(time.Duration(rand.Intn(randomDelayMax)) * time.Second)
+		h.registerWrongCodeAttempt(limiterKeys)
+		// the code itself is never logged, as it would be usable by anyone reading the logs
+		logger.Error.Printf("error when looking up code infos for %s: %v", uid, err)
+		h.writeDelayedCodeCheckResponse(c, start, http.StatusBadRequest, gin.H{"error": "wrong entry code"})
 		return
 	}
 
-	if codeInfos.UsedAt > 0 {
-		if !ok {
-			wrongCodeChecksPerUID[uid] = 1
-		} else {
-			wrongCodeChecksPerUID[uid] += 1
-		}
-		logger.Error.Printf("attempt to use expired code '%s': %v", code, codeInfos)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong entry code"})
-		time.Sleep(time.Duration(rand.Intn(randomDelayMax)) * time.Second)
+	if status := codeInfos.EffectiveStatus(time.Now().Unix()); status != types.ENTRY_CODE_STATUS_AVAILABLE {
+		h.registerWrongCodeAttempt(limiterKeys)
+		logger.Error.Printf("attempt by %s to use %s code %s (batch '%s')", uid, status, codeInfos.ID.Hex(), codeInfos.BatchID)
+		h.writeDelayedCodeCheckResponse(c, start, http.StatusBadRequest, gin.H{"error": "wrong entry code"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"isValid": true})
+	h.writeDelayedCodeCheckResponse(c, start, http.StatusOK, gin.H{"isValid": true})
 }
 
 func (h *HttpEndpoints) studyEventWithEntryCodeHandl(c *gin.Context) {
@@ -145,14 +190,14 @@ func (h *HttpEndpoints) studyEventWithEntryCodeHandl(c *gin.Context) {
 		return
 	}
 
-	codeSurveyItem, err := utils.FindSurveyItemResponse(req.Response.Responses, "CodeVal")
+	codeSurveyItem, err := utils.FindSurveyItemResponse(req.Response.Responses, h.surveyKeys.EntryCode.ItemKey, utils.ItemMatchMode(h.surveyKeys.EntryCode.MatchMode))
 	if err != nil {
 		logger.Debug.Printf("%v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	codeQuestionResponse, err := utils.FindResponseSlot(codeSurveyItem.Response, "rg.cv.ic")
+	codeQuestionResponse, err := utils.FindResponseSlot(codeSurveyItem.Response, h.surveyKeys.EntryCode.ResponseSlot)
 	if err != nil {
 		logger.Debug.Printf("%v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -160,7 +205,12 @@ func (h *HttpEndpoints) studyEventWithEntryCodeHandl(c *gin.Context) {
 	}
 
 	codeValue := codeQuestionResponse.Value
-	codeValue = SanitizeCode(codeValue)
+	codeValue, err = SanitizeCode(codeValue, h.entryCodeFormat)
+	if err != nil {
+		logger.Error.Printf("code value has wrong format: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code value has wrong format"})
+		return
+	}
 	if codeValue == "" {
 		logger.Error.Println("code value is empty")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "code value is empty"})
@@ -208,3 +258,62 @@ func (h *HttpEndpoints) isStudyFullEventHandl(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"value": true})
 }
+
+type codeAttemptLimiterKey struct {
+	limiter ratelimit.Limiter
+	key     string
+}
+
+// codeAttemptLimiterKeys returns the enabled limiters with the key used for this request
+func (h *HttpEndpoints) codeAttemptLimiterKeys(uid string, clientIP string) []codeAttemptLimiterKey {
+	keys := []codeAttemptLimiterKey{}
+	if h.uidLimiter != nil {
+		keys = append(keys, codeAttemptLimiterKey{limiter: h.uidLimiter, key: "uid:" + uid})
+	}
+	if h.ipLimiter != nil {
+		keys = append(keys, codeAttemptLimiterKey{limiter: h.ipLimiter, key: "ip:" + clientIP})
+	}
+	return keys
+}
+
+// codeAttemptRetryAfter returns the longest remaining lockout of the keys. Limiter errors are logged but don't block the attempt.
+func (h *HttpEndpoints) codeAttemptRetryAfter(keys []codeAttemptLimiterKey) time.Duration {
+	var retryAfter time.Duration
+	for _, k := range keys {
+		d, err := k.limiter.RetryAfter(k.key)
+		if err != nil {
+			logger.Error.Printf("unexpected error when checking rate limit for %s: %v", k.key, err)
+			continue
+		}
+		retryAfter = max(retryAfter, d)
+	}
+	return retryAfter
+}
+
+func (h *HttpEndpoints) registerWrongCodeAttempt(keys []codeAttemptLimiterKey) {
+	for _, k := range keys {
+		lockout, err := k.limiter.RegisterFailure(k.key)
+		if err != nil {
+			logger.Error.Printf("unexpected error when registering wrong code attempt for %s: %v", k.key, err)
+			continue
+		}
+		if lockout > 0 {
+			logger.Warning.Printf("%s locked out for %s after too many wrong code attempts", k.key, lockout)
+		}
+	}
+}
+
+// writeDelayedCodeCheckResponse writes the response once the configured response time since start has passed, so
+// all outcomes of a code check take the same time. Nothing is written if the client cancels the request meanwhile.
+func (h *HttpEndpoints) writeDelayedCodeCheckResponse(c *gin.Context, start time.Time, status int, obj any) {
+	timer := time.NewTimer(time.Until(start.Add(h.codeCheckResponse.ResponseTime)))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		c.JSON(status, obj)
+	case <-c.Request.Context().Done():
+		logger.Debug.Println("code check request cancelled by client before response")
+		c.Abort()
+	}
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/coneno/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/entrycodes"
+	mw "github.com/infectieradar-nl/self-swabbing-extension/pkg/http/middlewares"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/types"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultEntryCodePageSize    = 100
+	maxEntryCodePageSize        = 1000
+	maxGeneratedCodesPerRequest = 10000
+)
+
+func (h *HttpEndpoints) AddEntryCodeAdminAPI(rg *gin.RouterGroup) {
+	if len(h.adminAPIKeys) < 1 {
+		logger.Info.Println("no admin API keys configured, entry code admin endpoints are not available")
+		return
+	}
+
+	adminGroup := rg.Group("/entry-codes/:instanceID/admin")
+	adminGroup.Use(mw.HasValidInstanceID())
+	adminGroup.Use(mw.HasValidAPIKey(h.adminAPIKeys))
+	{
+		adminGroup.GET("/codes", h.listEntryCodesHandl)
+		adminGroup.GET("/codes/:code", h.getEntryCodeHandl)
+		adminGroup.GET("/export", h.exportEntryCodesHandl)
+		adminGroup.POST("/generate", mw.RequirePayload(), h.generateEntryCodesHandl)
+		adminGroup.POST("/batches/:batchID/revoke", h.revokeEntryCodeBatchHandl)
+		adminGroup.POST("/batches/:batchID/reactivate", h.reactivateEntryCodeBatchHandl)
+	}
+}
+
+func (h *HttpEndpoints) listEntryCodesHandl(c *gin.Context) {
+	instanceID := c.Param("instanceID")
+	if instanceID != h.instanceID {
+		msg := fmt.Sprintf("unexpected instanceID: %s", instanceID)
+		logger.Error.Println(msg)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	filter, err := parseEntryCodeFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive number"})
+		return
+	}
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", strconv.Itoa(defaultEntryCodePageSize)), 10, 64)
+	if err != nil || limit < 1 || limit > maxEntryCodePageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxEntryCodePageSize)})
+		return
+	}
+
+	codes, total, err := h.dbService.FindEntryCodes(instanceID, filter, page, limit)
+	if err != nil {
+		logger.Error.Printf("unexpected error when listing entry codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch entry codes"})
+		return
+	}
+	now := time.Now().Unix()
+	for i := range codes {
+		codes[i].Status = codes[i].EffectiveStatus(now)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"codes": codes,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+func (h *HttpEndpoints) getEntryCodeHandl(c *gin.Context) {
+	instanceID := c.Param("instanceID")
+	if instanceID != h.instanceID {
+		msg := fmt.Sprintf("unexpected instanceID: %s", instanceID)
+		logger.Error.Println(msg)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	code, err := SanitizeCode(c.Param("code"), h.entryCodeFormat)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "empty entry code"})
+		return
+	}
+
+	codeInfos, err := h.dbService.FindEntryCodeInfo(instanceID, code)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "entry code not found"})
+			return
+		}
+		logger.Error.Printf("unexpected error when looking up entry code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch entry code"})
+		return
+	}
+
+	codeInfos.Status = codeInfos.EffectiveStatus(time.Now().Unix())
+	c.JSON(http.StatusOK, codeInfos)
+}
+
+func (h *HttpEndpoints) exportEntryCodesHandl(c *gin.Context) {
+	instanceID := c.Param("instanceID")
+	if instanceID != h.instanceID {
+		msg := fmt.Sprintf("unexpected instanceID: %s", instanceID)
+		logger.Error.Println(msg)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	filter, err := parseEntryCodeFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now().Unix()
+	format := c.DefaultQuery("format", "csv")
+	filename := fmt.Sprintf("entry-codes_%s_%s", instanceID, time.Now().Format("2006-01-02-15-04-05"))
+
+	switch format {
+	case "csv":
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+		c.Status(http.StatusOK)
+
+		w := csv.NewWriter(c.Writer)
+		if err := w.Write(entryCodeCSVHeader()); err != nil {
+			logger.Error.Printf("error when writing entry code export: %v", err)
+			return
+		}
+		err = h.dbService.StreamEntryCodes(c.Request.Context(), instanceID, filter, func(code types.ValidationCode) error {
+			code.Status = code.EffectiveStatus(now)
+			return w.Write(entryCodeToCSVRow(code))
+		})
+		w.Flush()
+		if err == nil {
+			err = w.Error()
+		}
+	case "jsonl":
+		c.Header("Content-Type", "application/jsonl")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.jsonl", filename))
+		c.Status(http.StatusOK)
+
+		enc := json.NewEncoder(c.Writer)
+		err = h.dbService.StreamEntryCodes(c.Request.Context(), instanceID, filter, func(code types.ValidationCode) error {
+			code.Status = code.EffectiveStatus(now)
+			return enc.Encode(code)
+		})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown export format: %s", format)})
+		return
+	}
+
+	if err != nil {
+		// headers are already sent, so the error can only be logged
+		logger.Error.Printf("error when exporting entry codes: %v", err)
+	}
+}
+
+func (h *HttpEndpoints) generateEntryCodesHandl(c *gin.Context) {
+	instanceID := c.Param("instanceID")
+	if instanceID != h.instanceID {
+		msg := fmt.Sprintf("unexpected instanceID: %s", instanceID)
+		logger.Error.Println(msg)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var req types.GenerateCodesReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Count < 1 || req.Count > maxGeneratedCodesPerRequest {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("count must be between 1 and %d", maxGeneratedCodesPerRequest)})
+		return
+	}
+
+	err := h.dbService.CreateIndexForEntryCodes(instanceID)
+	if err != nil {
+		logger.Error.Printf("unexpected error when creating index: %v", err)
+	}
+
+	codes, err := h.entryCodeFormat.GenerateAndSave(req.Count, func(codes []string) (map[string]bool, error) {
+		entryCodes := make([]types.ValidationCode, len(codes))
+		for i, code := range codes {
+			entryCodes[i] = types.ValidationCode{Code: code, CodeBatchInfo: req.CodeBatchInfo}
+		}
+		return h.dbService.AddEntryCodes(instanceID, entryCodes)
+	})
+	if errors.Is(err, entrycodes.ErrCodeSpaceTooSmall) && len(codes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Error.Printf("error when generating entry codes (%d / %d saved): %v", len(codes), req.Count, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%d / %d codes generated: %v", len(codes), req.Count, err)})
+		return
+	}
+
+	for i, code := range codes {
+		codes[i] = h.entryCodeFormat.Group(code)
+	}
+	logger.Info.Printf("%d new entry codes generated", len(codes))
+	c.JSON(http.StatusOK, gin.H{"codes": codes})
+}
+
+func (h *HttpEndpoints) revokeEntryCodeBatchHandl(c *gin.Context) {
+	instanceID := c.Param("instanceID")
+	if instanceID != h.instanceID {
+		msg := fmt.Sprintf("unexpected instanceID: %s", instanceID)
+		logger.Error.Println(msg)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	batchID := c.Param("batchID")
+	count, err := h.dbService.RevokeEntryCodeBatch(instanceID, batchID)
+	if err != nil {
+		logger.Error.Printf("unexpected error when revoking batch '%s': %v", batchID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not revoke batch"})
+		return
+	}
+
+	logger.Info.Printf("%d codes of batch '%s' revoked", count, batchID)
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%d codes revoked", count), "count": count})
+}
+
+func (h *HttpEndpoints) reactivateEntryCodeBatchHandl(c *gin.Context) {
+	instanceID := c.Param("instanceID")
+	if instanceID != h.instanceID {
+		msg := fmt.Sprintf("unexpected instanceID: %s", instanceID)
+		logger.Error.Println(msg)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	batchID := c.Param("batchID")
+	count, err := h.dbService.ReactivateEntryCodeBatch(instanceID, batchID)
+	if err != nil {
+		logger.Error.Printf("unexpected error when reactivating batch '%s': %v", batchID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not reactivate batch"})
+		return
+	}
+
+	logger.Info.Printf("%d codes of batch '%s' reactivated", count, batchID)
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%d codes reactivated", count), "count": count})
+}
+
+func parseEntryCodeFilter(c *gin.Context) (types.EntryCodeFilter, error) {
+	filter := types.EntryCodeFilter{
+		UsedBy:  c.Query("usedBy"),
+		BatchID: c.Query("batchID"),
+	}
+
+	if status := c.Query("status"); status != "" {
+		switch status {
+		case types.ENTRY_CODE_STATUS_AVAILABLE, types.ENTRY_CODE_STATUS_USED, types.ENTRY_CODE_STATUS_REVOKED, types.ENTRY_CODE_STATUS_EXPIRED:
+			filter.Status = status
+		default:
+			return filter, fmt.Errorf("unknown status: %s", status)
+		}
+	}
+
+	if used := c.Query("used"); used != "" {
+		v, err := strconv.ParseBool(used)
+		if err != nil {
+			return filter, errors.New("used must be true or false")
+		}
+		filter.Used = &v
+	}
+
+	if from := c.Query("uploadedFrom"); from != "" {
+		v, err := strconv.ParseInt(from, 10, 64)
+		if err != nil {
+			return filter, errors.New("uploadedFrom must be a unix timestamp")
+		}
+		filter.UploadedFrom = v
+	}
+
+	if until := c.Query("uploadedUntil"); until != "" {
+		v, err := strconv.ParseInt(until, 10, 64)
+		if err != nil {
+			return filter, errors.New("uploadedUntil must be a unix timestamp")
+		}
+		filter.UploadedUntil = v
+	}
+	return filter, nil
+}
+
+func entryCodeCSVHeader() []string {
+	return []string{"id", "code", "batchID", "label", "status", "expiresAt", "uploadedAt", "usedAt", "usedBy"}
+}
+
+func entryCodeToCSVRow(code types.ValidationCode) []string {
+	return []string{
+		code.ID.Hex(),
+		code.Code,
+		code.BatchID,
+		code.Label,
+		code.Status,
+		strconv.FormatInt(code.ExpiresAt, 10),
+		strconv.FormatInt(code.UploadedAt, 10),
+		strconv.FormatInt(code.UsedAt, 10),
+		code.UsedBy,
+	}
+}
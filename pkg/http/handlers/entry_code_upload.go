@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/db"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/entrycodes"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/types"
+)
+
+const entryCodeUploadChunkSize = 1000
+
+// entryCodeCSVMapping defines the CSV header names of the code and of optional per-row batch metadata
+type entryCodeCSVMapping struct {
+	code      string
+	batchID   string
+	label     string
+	expiresAt string
+}
+
+// entryCodeUpload collects the per-code results of an upload, which can be processed in several chunks
+type entryCodeUpload struct {
+	instanceID      string
+	format          entrycodes.Format
+	dbService       *db.SelfSwabbingExtDBService
+	includeInserted bool
+	seen            map[string]bool
+	report          types.CodeUploadReport
+}
+
+// entryCodeUploadItem is a single uploaded code, err is set if the row could not be parsed
+type entryCodeUploadItem struct {
+	code      string
+	batchInfo types.CodeBatchInfo
+	err       error
+}
+
+func newEntryCodeUpload(
+	instanceID string,
+	format entrycodes.Format,
+	dbService *db.SelfSwabbingExtDBService,
+	dryRun bool,
+	includeInserted bool,
+) *entryCodeUpload {
+	return &entryCodeUpload{
+		instanceID:      instanceID,
+		format:          format,
+		dbService:       dbService,
+		includeInserted: includeInserted,
+		seen:            map[string]bool{},
+		report: types.CodeUploadReport{
+			DryRun:  dryRun,
+			Results: []types.CodeUploadResult{},
+		},
+	}
+}
+
+// addChunk sanitizes and validates the codes and, if not in dry-run mode, saves the valid ones with one bulk write
+func (u *entryCodeUpload) addChunk(items []entryCodeUploadItem) error {
+	results := make([]types.CodeUploadResult, len(items))
+	newCodes := []types.ValidationCode{}
+	newCodeKeys := []string{}
+	for i, item := range items {
+		results[i].Code = item.code
+		sanitized, err := SanitizeCode(item.code, u.format)
+		if item.err != nil {
+			err = item.err
+		}
+		switch {
+		case err != nil:
+			results[i].Result = types.CODE_UPLOAD_RESULT_INVALID_FORMAT
+			results[i].Error = err.Error()
+		case sanitized == "":
+			results[i].Result = types.CODE_UPLOAD_RESULT_EMPTY
+		case u.seen[sanitized]:
+			results[i].Sanitized = sanitized
+			results[i].Result = types.CODE_UPLOAD_RESULT_DUPLICATE
+			results[i].Error = "duplicate within upload"
+		default:
+			results[i].Sanitized = sanitized
+			u.seen[sanitized] = true
+			newCodes = append(newCodes, types.ValidationCode{Code: sanitized, CodeBatchInfo: item.batchInfo})
+			newCodeKeys = append(newCodeKeys, sanitized)
+		}
+	}
+
+	var existing map[string]bool
+	var err error
+	if u.report.DryRun {
+		existing, err = u.dbService.FindExistingEntryCodes(u.instanceID, newCodeKeys)
+	} else {
+		existing, err = u.dbService.AddEntryCodes(u.instanceID, newCodes)
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := range results {
+		if results[i].Result == "" {
+			if existing[results[i].Sanitized] {
+				results[i].Result = types.CODE_UPLOAD_RESULT_DUPLICATE
+			} else {
+				results[i].Result = types.CODE_UPLOAD_RESULT_INSERTED
+			}
+		}
+		u.countResult(results[i].Result)
+		if u.includeInserted || results[i].Result != types.CODE_UPLOAD_RESULT_INSERTED {
+			u.report.Results = append(u.report.Results, results[i])
+		}
+	}
+	return nil
+}
+
+func (u *entryCodeUpload) countResult(result string) {
+	u.report.Total += 1
+	switch result {
+	case types.CODE_UPLOAD_RESULT_INSERTED:
+		u.report.Inserted += 1
+	case types.CODE_UPLOAD_RESULT_DUPLICATE:
+		u.report.Duplicates += 1
+	case types.CODE_UPLOAD_RESULT_INVALID_FORMAT:
+		u.report.Invalid += 1
+	case types.CODE_UPLOAD_RESULT_EMPTY:
+		u.report.Empty += 1
+	}
+}
+
+// addFromCSV reads the CSV row by row and saves the codes in chunks, so large files are never fully held in memory.
+// Per-row metadata overrides the defaults, if the column is mapped and the value is not empty.
+func (u *entryCodeUpload) addFromCSV(r io.Reader, delimiter rune, mapping entryCodeCSVMapping, defaults types.CodeBatchInfo) error {
+	csvReader := csv.NewReader(r)
+	csvReader.Comma = delimiter
+	csvReader.FieldsPerRecord = -1
+	csvReader.ReuseRecord = true
+
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return errors.New("CSV file is empty")
+	}
+	if err != nil {
+		return fmt.Errorf("could not read CSV header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, h := range header {
+		h = strings.TrimPrefix(h, "\ufeff") // byte order mark added by some spreadsheet exports
+		columns[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+
+	findColumn := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		i, ok := columns[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return -1, fmt.Errorf("column '%s' not found in CSV header", name)
+		}
+		return i, nil
+	}
+	codeCol, err := findColumn(mapping.code)
+	if err != nil {
+		return err
+	}
+	if codeCol < 0 {
+		return errors.New("code column must be defined")
+	}
+	batchIDCol, err := findColumn(mapping.batchID)
+	if err != nil {
+		return err
+	}
+	labelCol, err := findColumn(mapping.label)
+	if err != nil {
+		return err
+	}
+	expiresAtCol, err := findColumn(mapping.expiresAt)
+	if err != nil {
+		return err
+	}
+
+	valueAt := func(record []string, col int) string {
+		if col < 0 || col >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[col])
+	}
+
+	chunk := make([]entryCodeUploadItem, 0, entryCodeUploadChunkSize)
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read CSV: %w", err)
+		}
+
+		item := entryCodeUploadItem{
+			code:      valueAt(record, codeCol),
+			batchInfo: defaults,
+		}
+		if v := valueAt(record, batchIDCol); v != "" {
+			item.batchInfo.BatchID = v
+		}
+		if v := valueAt(record, labelCol); v != "" {
+			item.batchInfo.Label = v
+		}
+		if v := valueAt(record, expiresAtCol); v != "" {
+			item.batchInfo.ExpiresAt, item.err = parseExpiresAt(v)
+		}
+		chunk = append(chunk, item)
+
+		if len(chunk) >= entryCodeUploadChunkSize {
+			if err := u.addChunk(chunk); err != nil {
+				return err
+			}
+			chunk = chunk[:0]
+		}
+	}
+	return u.addChunk(chunk)
+}
+
+// parseExpiresAt accepts unix timestamps and RFC 3339 dates
+func parseExpiresAt(v string) (int64, error) {
+	if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return ts, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid expiry date '%s', expected unix timestamp or RFC 3339 date", v)
+	}
+	return t.Unix(), nil
+}
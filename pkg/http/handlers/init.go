@@ -1,8 +1,11 @@
 package handlers
 
 import (
-	"github.com/coneno/logger"
+	"sync"
+
 	"github.com/infectieradar-nl/self-swabbing-extension/pkg/db"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/entrycodes"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/ratelimit"
 	"github.com/infectieradar-nl/self-swabbing-extension/pkg/sampler"
 	"github.com/infectieradar-nl/self-swabbing-extension/pkg/types"
 )
@@ -11,34 +14,61 @@ type HttpEndpoints struct {
 	instanceID           string
 	dbService            *db.SelfSwabbingExtDBService
 	apiKeys              []string
+	adminAPIKeys         []string
 	allowEntryCodeUpload bool
+	entryCodeFormat      entrycodes.Format
+	uidLimiter           ratelimit.Limiter
+	ipLimiter            ratelimit.Limiter
+	codeCheckResponse    types.CodeCheckResponseConfig
 	samplerConfig        types.SamplerConfig
+	surveyKeys           types.SurveyKeyMappings
 	sampler              *sampler.Sampler
+	samplerRefresh       sync.Mutex
 }
 
 func NewHTTPHandler(
 	instanceID string,
 	dbService *db.SelfSwabbingExtDBService,
 	apiKeys []string,
+	adminAPIKeys []string,
 	allowEntryCodeUpload bool,
+	entryCodeFormat entrycodes.Format,
+	uidLimiter ratelimit.Limiter,
+	ipLimiter ratelimit.Limiter,
+	codeCheckResponse types.CodeCheckResponseConfig,
 	samplerConfig types.SamplerConfig,
+	surveyKeys types.SurveyKeyMappings,
 ) *HttpEndpoints {
 
-	// in init:
-	s := sampler.NewSampler(instanceID, dbService)
-	s.LoadSlotCurveFromDB()
-	if s.NeedsRefresh() {
-		logger.Debug.Println("creating new slot curve from sample")
-		s.InitFromSampleCSV(samplerConfig.SampleFilePath, samplerConfig.TargetSamples, samplerConfig.OpenSlotsAtStart)
-		s.SaveSlotCurveToDB()
-	}
-
-	return &HttpEndpoints{
+	h := &HttpEndpoints{
 		instanceID:           instanceID,
 		dbService:            dbService,
 		apiKeys:              apiKeys,
+		adminAPIKeys:         adminAPIKeys,
 		allowEntryCodeUpload: allowEntryCodeUpload,
+		entryCodeFormat:      entryCodeFormat,
+		uidLimiter:           uidLimiter,
+		ipLimiter:            ipLimiter,
+		codeCheckResponse:    codeCheckResponse,
 		samplerConfig:        samplerConfig,
-		sampler:              s,
+		surveyKeys:           surveyKeys,
 	}
+
+	samplerOpts := []sampler.Option{sampler.WithCurveSource(samplerConfig.CurveSource)}
+	if samplerConfig.Seed != nil {
+		samplerOpts = append(samplerOpts, sampler.WithFixedSeed(*samplerConfig.Seed))
+	}
+	if len(samplerConfig.Strata.Strata) > 0 {
+		samplerOpts = append(samplerOpts, sampler.WithStrata(samplerConfig.Strata.Strata))
+	}
+	samplerOpts = append(samplerOpts, sampler.WithEligibilityRules(samplerConfig.Eligibility))
+	samplerOpts = append(samplerOpts, sampler.WithCarryOver(samplerConfig.CarryOver))
+	samplerOpts = append(samplerOpts, sampler.WithAdaptiveCurve(samplerConfig.Adaptive))
+	samplerOpts = append(samplerOpts, sampler.WithBlackouts(samplerConfig.Blackouts))
+	samplerOpts = append(samplerOpts, sampler.WithSlotRelease(samplerConfig.SlotRelease))
+	h.sampler = sampler.NewSampler(instanceID, dbService, samplerConfig.Interval, samplerOpts...)
+
+	// in init:
+	h.refreshSlotCurveIfNeeded()
+	return h
 }
@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/case-framework/case-backend/pkg/study/studyengine"
+	studyTypes "github.com/case-framework/case-backend/pkg/study/types"
 	"github.com/coneno/logger"
 	"github.com/gin-gonic/gin"
 	mw "github.com/infectieradar-nl/self-swabbing-extension/pkg/http/middlewares"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/sampler"
 	"github.com/infectieradar-nl/self-swabbing-extension/pkg/utils"
 )
 
@@ -23,6 +27,45 @@ func (h *HttpEndpoints) AddSamplerAPI(rg *gin.RouterGroup) {
 
 }
 
+// refreshSlotCurveIfNeeded switches to the slot curve of the current interval, and creates it from the curve source if there is none yet
+func (h *HttpEndpoints) refreshSlotCurveIfNeeded() {
+	h.samplerRefresh.Lock()
+	defer h.samplerRefresh.Unlock()
+
+	if !h.sampler.NeedsRefresh() {
+		return
+	}
+	// the curve might have been prepared in advance or created by another instance of the service
+	h.sampler.LoadSlotCurveFromDB()
+	if !h.sampler.NeedsRefresh() {
+		return
+	}
+
+	logger.Debug.Println("creating new slot curve from the curve source")
+	err := h.sampler.InitCurve(h.samplerConfig.TargetSamples, h.samplerConfig.OpenSlotsAtStart)
+	if err != nil {
+		logger.Error.Printf("could not create slot curve: %v", err)
+		// the file of the curve source might have been corrected since it was read
+		reloaded, reloadErr := h.sampler.ReloadSource()
+		if reloadErr != nil {
+			logger.Error.Printf("could not reload the curve source, keeping the one in use: %v", reloadErr)
+		} else if reloaded {
+			logger.Info.Println("curve source reloaded")
+			err = h.sampler.InitCurve(h.samplerConfig.TargetSamples, h.samplerConfig.OpenSlotsAtStart)
+			if err != nil {
+				logger.Error.Printf("could not create slot curve from the reloaded curve source: %v", err)
+			}
+		}
+	}
+	if err != nil {
+		if !h.sampler.KeepLastCurve() {
+			return
+		}
+		logger.Warning.Println("using the previous slot curve for the current interval")
+	}
+	h.sampler.SaveSlotCurveToDB()
+}
+
 func (h *HttpEndpoints) samplerGetStatus(c *gin.Context) {
 	instanceID := c.Param("instanceID")
 	if instanceID != h.instanceID {
@@ -32,12 +75,7 @@ func (h *HttpEndpoints) samplerGetStatus(c *gin.Context) {
 		return
 	}
 
-	// clean up unconfirmed reserved slots
-	if h.sampler.NeedsRefresh() {
-		logger.Debug.Println("creating new slot curve from sample")
-		h.sampler.InitFromSampleCSV(h.samplerConfig.SampleFilePath, h.samplerConfig.TargetSamples, h.samplerConfig.OpenSlotsAtStart)
-		h.sampler.SaveSlotCurveToDB()
-	}
+	h.refreshSlotCurveIfNeeded()
 
 	infos := h.sampler.GetSamplerInfos()
 
@@ -60,35 +98,115 @@ func (h *HttpEndpoints) samplerIsSelected(c *gin.Context) {
 		return
 	}
 
-	// clean up unconfirmed reserved slots
-	err := h.dbService.CleanUpExpiredSlotReservations(h.instanceID)
-	if err != nil {
-		logger.Error.Println(err)
+	// with adaptive curves, every call is recorded, selected or not, to adapt the slot curves to the actual arrivals
+	selected := false
+	defer func() {
+		h.sampler.RecordArrival(selected)
+	}()
+
+	h.refreshSlotCurveIfNeeded()
+
+	if err := h.sampler.CheckActive(); err != nil {
+		if errors.Is(err, sampler.ErrSamplerPaused) || errors.Is(err, sampler.ErrBlackout) {
+			logger.Debug.Printf("participant %s is not sampled: %v", req.ParticipantState.ParticipantID, err)
+		} else {
+			logger.Error.Println(err)
+		}
+		c.JSON(http.StatusOK, gin.H{"value": false})
+		return
 	}
 
-	if h.sampler.NeedsRefresh() {
-		logger.Debug.Println("creating new slot curve from sample")
-		h.sampler.InitFromSampleCSV(h.samplerConfig.SampleFilePath, h.samplerConfig.TargetSamples, h.samplerConfig.OpenSlotsAtStart)
-		h.sampler.SaveSlotCurveToDB()
+	stratum, err := h.participantStratum(req)
+	if err != nil {
+		logger.Debug.Printf("participant %s is not sampled: %v", req.ParticipantState.ParticipantID, err)
+		c.JSON(http.StatusOK, gin.H{"value": false})
+		return
 	}
 
-	if !h.sampler.HasAvailableFreeSlots() {
-		logger.Debug.Println("no free slots available")
+	var ineligible *sampler.IneligibleError
+	if err := h.sampler.CheckEligibility(req.ParticipantState.ParticipantID); errors.As(err, &ineligible) {
+		logger.Debug.Printf("participant %s is not sampled: %v", req.ParticipantState.ParticipantID, err)
+		c.JSON(http.StatusOK, gin.H{"value": false})
+		return
+	} else if err != nil {
+		logger.Error.Println(err)
 		c.JSON(http.StatusOK, gin.H{"value": false})
 		return
 	}
 
 	// reserve slot:
-	err = h.dbService.ReserveSlot(instanceID, req.ParticipantState.ParticipantID)
+	reserved, err := h.sampler.TryReserveSlot(req.ParticipantState.ParticipantID, stratum)
+	if errors.Is(err, sampler.ErrUnknownStratum) {
+		logger.Debug.Printf("participant %s is not sampled: %v", req.ParticipantState.ParticipantID, err)
+		c.JSON(http.StatusOK, gin.H{"value": false})
+		return
+	}
 	if err != nil {
 		logger.Error.Println(err)
 		c.JSON(http.StatusOK, gin.H{"value": false})
 		return
 	}
+	if !reserved {
+		logger.Debug.Println("no free slots available")
+		c.JSON(http.StatusOK, gin.H{"value": false})
+		return
+	}
 	logger.Debug.Printf("participant %s was sampled", req.ParticipantState.ParticipantID)
+	selected = true
 	c.JSON(http.StatusOK, gin.H{"value": true})
 }
 
+// participantStratum derives the stratum key from the configured participant flags and survey responses.
+// Values without a stratum of their own fall back to the default stratum, if configured.
+func (h *HttpEndpoints) participantStratum(req studyengine.ExternalEventPayload) (string, error) {
+	conf := h.samplerConfig.Strata
+	if len(conf.Attributes) < 1 {
+		return "", nil
+	}
+
+	values := make([]string, len(conf.Attributes))
+	for i, a := range conf.Attributes {
+		if a.Flag != "" {
+			v, ok := req.ParticipantState.Flags[a.Flag]
+			if !ok && conf.DefaultStratum == "" {
+				return "", fmt.Errorf("participant flag '%s' is not set", a.Flag)
+			}
+			values[i] = v
+			continue
+		}
+
+		item, err := utils.FindSurveyItemResponse(req.Response.Responses, a.Survey.ItemKey, utils.ItemMatchMode(a.Survey.MatchMode))
+		if err == nil {
+			var slot *studyTypes.ResponseItem
+			slot, err = utils.FindResponseSlot(item.Response, a.Survey.ResponseSlot)
+			if err == nil {
+				switch {
+				case len(slot.Items) == 1:
+					values[i] = slot.Items[0].Key
+				case slot.Value != "":
+					values[i] = slot.Value
+				default:
+					err = fmt.Errorf("no single value in response slot %s", a.Survey.ResponseSlot)
+				}
+			}
+		}
+		if err != nil && conf.DefaultStratum == "" {
+			return "", err
+		}
+	}
+
+	stratum := strings.Join(values, "|")
+	for _, st := range conf.Strata {
+		if st.Key == stratum {
+			return stratum, nil
+		}
+	}
+	if conf.DefaultStratum != "" {
+		return conf.DefaultStratum, nil
+	}
+	return "", fmt.Errorf("no stratum defined for '%s'", stratum)
+}
+
 func (h *HttpEndpoints) samplerInviteResponse(c *gin.Context) {
 	var req studyengine.ExternalEventPayload
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -105,14 +223,14 @@ func (h *HttpEndpoints) samplerInviteResponse(c *gin.Context) {
 		return
 	}
 
-	confirmSurveyItem, err := utils.FindSurveyItemResponse(req.Response.Responses, "SwabSample.Confirm")
+	confirmSurveyItem, err := utils.FindSurveyItemResponse(req.Response.Responses, h.surveyKeys.InviteResponse.ItemKey, utils.ItemMatchMode(h.surveyKeys.InviteResponse.MatchMode))
 	if err != nil {
 		logger.Debug.Printf("%v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	confirmedResponse, err := utils.FindResponseSlot(confirmSurveyItem.Response, "rg.scg")
+	confirmedResponse, err := utils.FindResponseSlot(confirmSurveyItem.Response, h.surveyKeys.InviteResponse.ResponseSlot)
 	if err != nil {
 		logger.Debug.Printf("%v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -130,7 +248,7 @@ func (h *HttpEndpoints) samplerInviteResponse(c *gin.Context) {
 
 	logger.Debug.Printf("SwabSample invite response submitted by [%s] with selected option '%s'", req.ParticipantState.ParticipantID, confirmedResponse.Items[0].Key)
 
-	if confirmedResponse.Items[0].Key == "1" {
+	if isAcceptedOption(confirmedResponse.Items[0].Key, h.surveyKeys.InviteResponse.AcceptedOptions) {
 		// Confirmed participation:
 		err := h.dbService.ConfirmSlot(instanceID, req.ParticipantState.ParticipantID)
 		if err != nil {
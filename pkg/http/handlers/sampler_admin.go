@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/coneno/logger"
+	"github.com/gin-gonic/gin"
+	mw "github.com/infectieradar-nl/self-swabbing-extension/pkg/http/middlewares"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/sampler"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/types"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (h *HttpEndpoints) AddSamplerAdminAPI(rg *gin.RouterGroup) {
+	if len(h.adminAPIKeys) < 1 {
+		logger.Info.Println("no admin API keys configured, sampler admin endpoints are not available")
+		return
+	}
+
+	adminGroup := rg.Group("/sampler/:instanceID/admin")
+	adminGroup.Use(mw.HasValidInstanceID())
+	adminGroup.Use(mw.HasValidAPIKey(h.adminAPIKeys))
+	{
+		adminGroup.GET("/curve", h.getSlotCurveHandl)
+		adminGroup.GET("/curve/versions", h.getSlotCurveVersionsHandl)
+		adminGroup.POST("/curve", mw.RequirePayload(), h.uploadSlotCurveHandl)
+		adminGroup.POST("/curve/regenerate", h.regenerateSlotCurveHandl)
+		adminGroup.GET("/report", h.getSamplerReportHandl)
+		adminGroup.GET("/state", h.getSamplerStateHandl)
+		adminGroup.POST("/state", mw.RequirePayload(), h.setSamplerStateHandl)
+	}
+}
+
+func (h *HttpEndpoints) getSlotCurveHandl(c *gin.Context) {
+	instanceID := c.Param("instanceID")
+	if instanceID != h.instanceID {
+		msg := fmt.Sprintf("unexpected instanceID: %s", instanceID)
+		logger.Error.Println(msg)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if c.Query("intervalStart") == "" {
+		h.refreshSlotCurveIfNeeded()
+		c.JSON(http.StatusOK, h.sampler.Curve())
+		return
+	}
+
+	intervalStart, err := parseIntervalStartQuery(c, h.sampler.Interval().IntervalStartAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	curve, err := h.dbService.LoadLatestSlotCurve(instanceID, intervalStart)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no slot curve for this interval"})
+			return
+		}
+		logger.Error.Printf("unexpected error when loading slot curve: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load slot curve"})
+		return
+	}
+	c.JSON(http.StatusOK, curve)
+}
+
+func (h *HttpEndpoints) getSlotCurveVersionsHandl(c *gin.Context) {
+	instanceID := c.Param("instanceID")
+	if instanceID != h.instanceID {
+		msg := fmt.Sprintf("unexpected instanceID: %s", instanceID)
+		logger.Error.Println(msg)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	intervalStart, err := parseIntervalStartQuery(c, h.sampler.Interval().IntervalStartAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	curves, err := h.dbService.FindSlotCurveVersions(instanceID, intervalStart)
+	if err != nil {
+		logger.Error.Printf("unexpected error when loading slot curve versions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load slot curves"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"intervalStart": intervalStart, "versions": curves})
+}
+
+func (h *HttpEndpoints) uploadSlotCurveHandl(c *gin.Context) {
+	instanceID := c.Param("instanceID")
+	if instanceID != h.instanceID {
+		msg := fmt.Sprintf("unexpected instanceID: %s", instanceID)
+		logger.Error.Println(msg)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var req types.UploadSlotCurveReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	intervalStart, err := h.targetIntervalStart(req.IntervalStart)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var curve sampler.SlotCurve
+	if len(req.Strata) > 0 {
+		if len(req.OpenSlots) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "either openSlots or strata can be set"})
+			return
+		}
+		curve, err = h.sampler.NewStratifiedSlotCurve(req.Strata, intervalStart)
+	} else {
+		curve, err = h.sampler.NewSlotCurve(req.OpenSlots, intervalStart)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.saveSlotCurveVersion(c, curve)
+}
+
+func (h *HttpEndpoints) regenerateSlotCurveHandl(c *gin.Context) {
+	instanceID := c.Param("instanceID")
+	if instanceID != h.instanceID {
+		msg := fmt.Sprintf("unexpected instanceID: %s", instanceID)
+		logger.Error.Println(msg)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var req types.RegenerateSlotCurveReq
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if h.sampler.Stratified() && (req.TargetSamples != nil || req.OpenSlotsAtStart != nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "targets are defined per stratum in the strata config"})
+		return
+	}
+
+	target := h.samplerConfig.TargetSamples
+	if req.TargetSamples != nil {
+		target = *req.TargetSamples
+	}
+	openSlotsAtStart := h.samplerConfig.OpenSlotsAtStart
+	if req.OpenSlotsAtStart != nil {
+		openSlotsAtStart = *req.OpenSlotsAtStart
+	}
+	if openSlotsAtStart < 0 || target < openSlotsAtStart {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "targetSamples must be at least openSlotsAtStart, which must not be negative"})
+		return
+	}
+
+	intervalStart, err := h.targetIntervalStart(req.IntervalStart)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	seed := h.sampler.NewSeed()
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+	// an explicit target replaces the configured one including carried over slots
+	carried := map[string]int{}
+	if req.TargetSamples == nil {
+		carried = h.sampler.CarryOverTo(intervalStart)
+	}
+	curve, err := h.sampler.DrawSlotCurve(target, openSlotsAtStart, intervalStart, seed, carried)
+	if err != nil {
+		logger.Error.Printf("unexpected error when drawing slot curve: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not draw slot curve: " + err.Error()})
+		return
+	}
+
+	h.saveSlotCurveVersion(c, curve)
+}
+
+func (h *HttpEndpoints) getSamplerStateHandl(c *gin.Context) {
+	instanceID := c.Param("instanceID")
+	if instanceID != h.instanceID {
+		msg := fmt.Sprintf("unexpected instanceID: %s", instanceID)
+		logger.Error.Println(msg)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	state, err := h.sampler.State()
+	if err != nil {
+		logger.Error.Printf("unexpected error when loading sampler state: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load sampler state"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"state": state, "nextBlackout": h.sampler.NextBlackout(time.Now())})
+}
+
+func (h *HttpEndpoints) setSamplerStateHandl(c *gin.Context) {
+	instanceID := c.Param("instanceID")
+	if instanceID != h.instanceID {
+		msg := fmt.Sprintf("unexpected instanceID: %s", instanceID)
+		logger.Error.Println(msg)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var req types.SetSamplerStateReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.State != sampler.SAMPLER_STATE_ACTIVE && req.State != sampler.SAMPLER_STATE_PAUSED {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "state must be active or paused"})
+		return
+	}
+
+	state, err := h.sampler.SetState(req.State, req.Reason)
+	if err != nil {
+		logger.Error.Printf("unexpected error when saving sampler state: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save sampler state"})
+		return
+	}
+	logger.Info.Printf("sampler state set to %s (%s)", state.State, state.Reason)
+	c.JSON(http.StatusOK, state)
+}
+
+func (h *HttpEndpoints) getSamplerReportHandl(c *gin.Context) {
+	instanceID := c.Param("instanceID")
+	if instanceID != h.instanceID {
+		msg := fmt.Sprintf("unexpected instanceID: %s", instanceID)
+		logger.Error.Println(msg)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	from, err := strconv.ParseInt(c.DefaultQuery("from", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a unix timestamp"})
+		return
+	}
+	until, err := strconv.ParseInt(c.DefaultQuery("until", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "until must be a unix timestamp"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown report format: %s", format)})
+		return
+	}
+
+	reports, err := h.dbService.GetSamplerReport(instanceID, h.sampler.Interval(), from, until)
+	if err != nil {
+		logger.Error.Printf("unexpected error when creating sampler report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create sampler report"})
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, gin.H{"intervals": reports})
+		return
+	}
+
+	filename := fmt.Sprintf("sampler-report_%s_%s", instanceID, time.Now().Format("2006-01-02-15-04-05"))
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	if err := w.Write(sampler.IntervalReportCSVHeader()); err != nil {
+		logger.Error.Printf("error when writing sampler report: %v", err)
+		return
+	}
+	for _, r := range reports {
+		if err := w.Write(r.CSVRow()); err != nil {
+			logger.Error.Printf("error when writing sampler report: %v", err)
+			return
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		logger.Error.Printf("error when writing sampler report: %v", err)
+	}
+}
+
+func (h *HttpEndpoints) saveSlotCurveVersion(c *gin.Context, curve sampler.SlotCurve) {
+	h.samplerRefresh.Lock()
+	defer h.samplerRefresh.Unlock()
+
+	saved, err := h.sampler.SaveSlotCurveVersion(curve)
+	if err != nil {
+		logger.Error.Printf("unexpected error when saving slot curve: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save slot curve"})
+		return
+	}
+	logger.Info.Printf("slot curve version %d saved for interval starting at %d (%s)", saved.Version, saved.IntervalStart, saved.Source)
+	c.JSON(http.StatusOK, saved)
+}
+
+// targetIntervalStart returns the start of the interval containing ref (unix timestamp), or of the current interval if ref is 0.
+// Curves of past intervals can't be changed.
+func (h *HttpEndpoints) targetIntervalStart(ref int64) (time.Time, error) {
+	interval := h.sampler.Interval()
+	current := h.sampler.IntervalStartNow()
+	if ref == 0 {
+		return current, nil
+	}
+	intervalStart := interval.IntervalStartAt(time.Unix(ref, 0))
+	if intervalStart.Before(current) {
+		return intervalStart, errors.New("slot curves of past intervals can't be changed")
+	}
+	return intervalStart, nil
+}
+
+// parseIntervalStartQuery reads the intervalStart query parameter (any unix timestamp inside the interval), defaults to now
+func parseIntervalStartQuery(c *gin.Context, intervalStartAt func(time.Time) time.Time) (int64, error) {
+	ref := time.Now()
+	if v := c.Query("intervalStart"); v != "" {
+		ts, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, errors.New("intervalStart must be a unix timestamp")
+		}
+		ref = time.Unix(ts, 0)
+	}
+	return intervalStartAt(ref).Unix(), nil
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/coneno/logger"
 	"github.com/gin-gonic/gin"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/entrycodes"
 )
 
 func RecordBodyHandl(c *gin.Context) {
@@ -36,9 +37,26 @@ func RecordBodyHandl(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Your file has been successfully saved."})
 }
 
-func SanitizeCode(code string) string {
+// SanitizeCode removes separators from the code and checks it against the configured code format
+func SanitizeCode(code string, format entrycodes.Format) (string, error) {
 	code = strings.ReplaceAll(code, " ", "")
 	code = strings.ReplaceAll(code, "_", "")
 	code = strings.ReplaceAll(code, "-", "")
-	return code
+	if code == "" || !format.CheckDigit {
+		return code, nil
+	}
+	code = format.Normalize(code)
+	if err := format.Check(code); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+func isAcceptedOption(key string, acceptedOptions []string) bool {
+	for _, o := range acceptedOptions {
+		if o == key {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/entrycodes"
+)
+
+func TestSanitizeCodeRoundTrip(t *testing.T) {
+	format := entrycodes.Format{Alphabet: entrycodes.DefaultAlphabet, Length: 10, GroupSize: 5, CheckDigit: true}
+	codes, err := format.Generate(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range codes {
+		grouped := format.Group(code)
+		inputs := []string{
+			grouped,
+			strings.ToLower(grouped),
+			" " + strings.ReplaceAll(grouped, "-", " ") + " ",
+			strings.ReplaceAll(grouped, "-", "_"),
+		}
+		for _, input := range inputs {
+			got, err := SanitizeCode(input, format)
+			if err != nil || got != code {
+				t.Errorf("%s: expected %s, got %s, %v", input, code, got, err)
+			}
+		}
+	}
+}
+
+func TestSanitizeCodeRejectsWrongCheckDigit(t *testing.T) {
+	format := entrycodes.Format{Alphabet: entrycodes.DefaultAlphabet, Length: 10, GroupSize: 5, CheckDigit: true}
+	codes, err := format.Generate(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := codes[0]
+	replacement := "2"
+	if code[0] == '2' {
+		replacement = "3"
+	}
+	if _, err := SanitizeCode(format.Group(replacement+code[1:]), format); !errors.Is(err, entrycodes.ErrInvalidCheckDigit) {
+		t.Errorf("expected ErrInvalidCheckDigit, got %v", err)
+	}
+
+	// without check digits, codes are only stripped of separators
+	format.CheckDigit = false
+	if got, err := SanitizeCode("ab-c d_e", format); err != nil || got != "abcde" {
+		t.Errorf("expected abcde, got %s, %v", got, err)
+	}
+}
@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LimitConcurrentRequests rejects requests with 429 while maxConcurrent requests are already being handled
+func LimitConcurrentRequests(maxConcurrent int) gin.HandlerFunc {
+	slots := make(chan struct{}, maxConcurrent)
+	return func(c *gin.Context) {
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			c.Next()
+		default:
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryLimiter keeps the failure history in memory, it is not shared between replicas and lost on restart
+type MemoryLimiter struct {
+	cfg       Config
+	now       func() time.Time
+	mu        sync.Mutex
+	states    map[string]State
+	lastSweep time.Time
+}
+
+func NewMemoryLimiter(cfg Config) *MemoryLimiter {
+	return &MemoryLimiter{
+		cfg:    cfg,
+		now:    time.Now,
+		states: map[string]State{},
+	}
+}
+
+func (l *MemoryLimiter) RetryAfter(key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.cfg.retryAfter(l.states[key], l.now()), nil
+}
+
+func (l *MemoryLimiter) RegisterFailure(key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	state, lockout := l.cfg.registerFailure(l.states[key], now)
+	l.states[key] = state
+	return lockout, nil
+}
+
+// sweep removes expired states, at most once per window
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.cfg.Window {
+		return
+	}
+	for k, s := range l.states {
+		if s.ExpiresAt.Before(now) {
+			delete(l.states, k)
+		}
+	}
+	l.lastSweep = now
+}
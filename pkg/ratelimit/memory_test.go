@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func testConfig() Config {
+	return Config{
+		MaxFailures: 3,
+		Window:      5 * time.Minute,
+		LockoutBase: 5 * time.Minute,
+		LockoutMax:  30 * time.Minute,
+	}
+}
+
+// newTestLimiter returns a memory limiter with a clock that only moves with the returned function
+func newTestLimiter() (*MemoryLimiter, func(d time.Duration)) {
+	now := time.Date(2025, time.March, 5, 12, 0, 0, 0, time.UTC)
+	l := NewMemoryLimiter(testConfig())
+	l.now = func() time.Time { return now }
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func registerFailure(t *testing.T, l *MemoryLimiter, key string) time.Duration {
+	t.Helper()
+	lockout, err := l.RegisterFailure(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lockout
+}
+
+func retryAfter(t *testing.T, l *MemoryLimiter, key string) time.Duration {
+	t.Helper()
+	d, err := l.RetryAfter(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestMemoryLimiterSlidingWindow(t *testing.T) {
+	l, advance := newTestLimiter()
+
+	registerFailure(t, l, "uid:1")
+	advance(2 * time.Minute)
+	registerFailure(t, l, "uid:1")
+	// the first failure leaves the window
+	advance(3*time.Minute + time.Second)
+	if lockout := registerFailure(t, l, "uid:1"); lockout != 0 {
+		t.Fatalf("expected no lockout with 2 failures in the window, got %s", lockout)
+	}
+	if d := retryAfter(t, l, "uid:1"); d != 0 {
+		t.Fatalf("expected no lockout, got %s", d)
+	}
+
+	advance(time.Minute)
+	if lockout := registerFailure(t, l, "uid:1"); lockout != 5*time.Minute {
+		t.Fatalf("expected a lockout of 5m with 3 failures in the window, got %s", lockout)
+	}
+	if d := retryAfter(t, l, "uid:1"); d != 5*time.Minute {
+		t.Errorf("expected retry after 5m, got %s", d)
+	}
+	if d := retryAfter(t, l, "uid:2"); d != 0 {
+		t.Errorf("other keys must not be locked out, got %s", d)
+	}
+	advance(2 * time.Minute)
+	if d := retryAfter(t, l, "uid:1"); d != 3*time.Minute {
+		t.Errorf("expected retry after 3m, got %s", d)
+	}
+	advance(3 * time.Minute)
+	if d := retryAfter(t, l, "uid:1"); d != 0 {
+		t.Errorf("expected the lockout to be over, got %s", d)
+	}
+}
+
+func TestMemoryLimiterExponentialLockout(t *testing.T) {
+	l, advance := newTestLimiter()
+
+	for _, want := range []time.Duration{5 * time.Minute, 10 * time.Minute, 20 * time.Minute, 30 * time.Minute, 30 * time.Minute} {
+		var lockout time.Duration
+		for i := 0; i < 3; i++ {
+			lockout = registerFailure(t, l, "ip:1")
+			advance(time.Second)
+		}
+		if lockout != want {
+			t.Fatalf("expected a lockout of %s, got %s", want, lockout)
+		}
+		// the next failures come right after the lockout
+		advance(lockout)
+	}
+}
+
+func TestMemoryLimiterLockoutResetsAfterQuietWindow(t *testing.T) {
+	l, advance := newTestLimiter()
+
+	for i := 0; i < 3; i++ {
+		registerFailure(t, l, "uid:1")
+	}
+	advance(5 * time.Minute)
+	for i := 0; i < 3; i++ {
+		registerFailure(t, l, "uid:1")
+	}
+	// a full window without failures after the second lockout (10m)
+	advance(10*time.Minute + 5*time.Minute + time.Second)
+	var lockout time.Duration
+	for i := 0; i < 3; i++ {
+		lockout = registerFailure(t, l, "uid:1")
+	}
+	if lockout != 5*time.Minute {
+		t.Errorf("expected the lockout to start again at 5m, got %s", lockout)
+	}
+}
+
+func TestMemoryLimiterRemovesExpiredStates(t *testing.T) {
+	l, advance := newTestLimiter()
+
+	registerFailure(t, l, "uid:1")
+	advance(10 * time.Minute)
+	registerFailure(t, l, "uid:2")
+
+	if _, ok := l.states["uid:1"]; ok {
+		t.Error("expected the expired state to be removed")
+	}
+	if _, ok := l.states["uid:2"]; !ok {
+		t.Error("expected the new state to be kept")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(c *Config)
+		wantErr bool
+	}{
+		{"valid", func(c *Config) {}, false},
+		{"no failures", func(c *Config) { c.MaxFailures = 0 }, true},
+		{"no window", func(c *Config) { c.Window = 0 }, true},
+		{"no lockout", func(c *Config) { c.LockoutBase = 0 }, true},
+		{"max lockout shorter than lockout", func(c *Config) { c.LockoutMax = time.Minute }, true},
+	}
+	for _, tt := range tests {
+		c := testConfig()
+		tt.change(&c)
+		if err := c.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error: %t, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
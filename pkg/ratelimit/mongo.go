@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"errors"
+	"time"
+)
+
+const maxSaveAttempts = 5
+
+// MongoLimiter stores the failure history in the database, so it is shared between replicas and survives restarts
+type MongoLimiter struct {
+	cfg        Config
+	instanceID string
+	dbService  RateLimitDBService
+}
+
+func NewMongoLimiter(cfg Config, instanceID string, dbService RateLimitDBService) *MongoLimiter {
+	return &MongoLimiter{
+		cfg:        cfg,
+		instanceID: instanceID,
+		dbService:  dbService,
+	}
+}
+
+func (l *MongoLimiter) RetryAfter(key string) (time.Duration, error) {
+	state, err := l.dbService.LoadRateLimitState(l.instanceID, key)
+	if err != nil {
+		return 0, err
+	}
+	return l.cfg.retryAfter(state, time.Now()), nil
+}
+
+func (l *MongoLimiter) RegisterFailure(key string) (time.Duration, error) {
+	for attempt := 0; attempt < maxSaveAttempts; attempt++ {
+		state, err := l.dbService.LoadRateLimitState(l.instanceID, key)
+		if err != nil {
+			return 0, err
+		}
+		state.Key = key
+
+		expectedVersion := state.Version
+		newState, lockout := l.cfg.registerFailure(state, time.Now())
+		newState.Version = expectedVersion + 1
+
+		saved, err := l.dbService.SaveRateLimitState(l.instanceID, newState, expectedVersion)
+		if err != nil {
+			return 0, err
+		}
+		if saved {
+			return lockout, nil
+		}
+		// state was modified concurrently, retry with the latest version
+	}
+	return 0, errors.New("could not save rate limit state due to concurrent updates")
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (cfg Config) Validate() error {
+	if cfg.MaxFailures < 1 {
+		return errors.New("max failures must be at least 1")
+	}
+	if cfg.Window <= 0 {
+		return errors.New("window must be positive")
+	}
+	if cfg.LockoutBase <= 0 {
+		return errors.New("lockout duration must be positive")
+	}
+	if cfg.LockoutMax < cfg.LockoutBase {
+		return fmt.Errorf("max lockout (%s) must not be shorter than the lockout duration (%s)", cfg.LockoutMax, cfg.LockoutBase)
+	}
+	return nil
+}
+
+func (cfg Config) retryAfter(s State, now time.Time) time.Duration {
+	lockedUntil := time.UnixMilli(s.LockedUntil)
+	if lockedUntil.After(now) {
+		return lockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// registerFailure returns the new state after a failure at now and the lockout it caused
+func (cfg Config) registerFailure(s State, now time.Time) (State, time.Duration) {
+	nowMs := now.UnixMilli()
+	windowStart := now.Add(-cfg.Window).UnixMilli()
+
+	failures := make([]int64, 0, len(s.Failures)+1)
+	for _, f := range s.Failures {
+		if f > windowStart {
+			failures = append(failures, f)
+		}
+	}
+	if len(failures) == 0 && s.LockedUntil < windowStart {
+		// a full window without failures since the last lockout
+		s.Lockouts = 0
+	}
+	s.Failures = append(failures, nowMs)
+
+	var lockout time.Duration
+	if len(s.Failures) >= cfg.MaxFailures {
+		lockout = cfg.LockoutBase
+		for i := 0; i < s.Lockouts && lockout < cfg.LockoutMax; i++ {
+			lockout *= 2
+		}
+		lockout = min(lockout, cfg.LockoutMax)
+
+		s.LockedUntil = now.Add(lockout).UnixMilli()
+		s.Lockouts += 1
+		s.Failures = []int64{}
+	}
+
+	// keep the state for one more window after the lockout, so the lockout count is not forgotten early
+	s.ExpiresAt = time.UnixMilli(max(s.LockedUntil, nowMs)).Add(cfg.Window)
+	return s, lockout
+}
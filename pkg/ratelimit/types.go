@@ -0,0 +1,35 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+// Limiter tracks failed attempts per key (e.g. participant ID or client IP) and locks keys out after too many failures
+type Limiter interface {
+	// RetryAfter returns how long the key is still locked out, zero if attempts are allowed
+	RetryAfter(key string) (time.Duration, error)
+	// RegisterFailure records a failed attempt and returns the lockout duration caused by it, if any
+	RegisterFailure(key string) (time.Duration, error)
+}
+
+type Config struct {
+	MaxFailures int           // number of failures within Window that trigger a lockout
+	Window      time.Duration // length of the sliding window failures are counted in
+	LockoutBase time.Duration // duration of the first lockout, doubled with each further lockout
+	LockoutMax  time.Duration // upper bound for the lockout duration
+}
+
+// State is the failure history of a single key
+type State struct {
+	Key         string    `bson:"key"`
+	Failures    []int64   `bson:"failures"`    // unix milliseconds of the failures within the window, oldest first
+	LockedUntil int64     `bson:"lockedUntil"` // unix milliseconds
+	Lockouts    int       `bson:"lockouts"`    // number of consecutive lockouts, reset after a quiet window
+	Version     int64     `bson:"version"`     // used for optimistic concurrency control
+	ExpiresAt   time.Time `bson:"expiresAt"`   // after this, the state is irrelevant and can be removed
+}
+
+type RateLimitDBService interface {
+	LoadRateLimitState(instanceID string, key string) (state State, err error)
+	SaveRateLimitState(instanceID string, state State, expectedVersion int64) (saved bool, err error)
+}
@@ -0,0 +1,143 @@
+package sampler
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/coneno/logger"
+)
+
+// AdaptiveConfig makes new slot curves follow the /is-selected arrivals of the previous intervals, zero Intervals disables it
+type AdaptiveConfig struct {
+	Intervals   int     // number of previous intervals whose recorded arrivals are used
+	Weight      float64 // share of the slot openings drawn from the recorded arrivals, the rest is drawn from the curve source
+	MinArrivals int     // with fewer recorded arrivals, only the curve source is used
+}
+
+// WithAdaptiveCurve blends the recorded arrivals into new curves, the curve source must implement TimeSampler
+func WithAdaptiveCurve(conf AdaptiveConfig) Option {
+	return func(s *Sampler) {
+		s.adaptive = conf
+	}
+}
+
+// RecordArrival stores an /is-selected call, selected or not, as input for adaptive slot curves. Nothing is stored if adaptive curves are disabled.
+// The arrival expires at the end of the last interval whose curve can use it.
+func (s *Sampler) RecordArrival(selected bool) {
+	if s.adaptive.Intervals < 1 {
+		return
+	}
+	now := s.now()
+	expiresAt := s.interval.IntervalStartAt(now)
+	for i := 0; i <= s.adaptive.Intervals; i++ {
+		expiresAt = s.interval.IntervalEnd(expiresAt)
+	}
+	err := s.dbService.SaveArrival(s.instanceID, RecordedArrival{
+		Time:      now.Unix(),
+		Selected:  selected,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		logger.Error.Printf("error when recording arrival: %v", err)
+	}
+}
+
+// observedShares returns the recorded arrivals of the intervals before intervalStart, as share (0 - 1) of their own interval
+func (s *Sampler) observedShares(intervalStart time.Time) ([]float64, error) {
+	from := intervalStart
+	for i := 0; i < s.adaptive.Intervals; i++ {
+		from = s.interval.IntervalStartAt(from.Add(-time.Second))
+	}
+	times, err := s.dbService.FindArrivalTimes(s.instanceID, from.Unix(), intervalStart.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	shares := make([]float64, len(times))
+	for i, t := range times {
+		start := s.interval.IntervalStartAt(time.Unix(t, 0))
+		end := s.interval.IntervalEnd(start)
+		shares[i] = float64(t-start.Unix()) / float64(end.Unix()-start.Unix())
+	}
+	return shares, nil
+}
+
+// curveSourceFor returns the source of the curve of the interval starting at intervalStart: the curve source blended with the recorded arrivals
+// if adaptive curves are enabled and enough arrivals were recorded, otherwise the curve source itself.
+func (s *Sampler) curveSourceFor(intervalStart time.Time) (CurveSource, int) {
+	source := s.Source()
+	ts, ok := source.(TimeSampler)
+	if s.adaptive.Intervals < 1 || s.adaptive.Weight <= 0 || !ok {
+		return source, 0
+	}
+
+	shares, err := s.observedShares(intervalStart)
+	if err != nil {
+		logger.Error.Printf("error when loading recorded arrivals, using the curve source only: %v", err)
+		return source, 0
+	}
+	if len(shares) < s.adaptive.MinArrivals || len(shares) < 1 {
+		logger.Debug.Printf("only %d recorded arrivals, using the curve source only", len(shares))
+		return source, 0
+	}
+	return &blendedSource{
+		CurveSource: source,
+		base:        ts,
+		observed:    shares,
+		weight:      s.adaptive.Weight,
+	}, len(shares)
+}
+
+// blendedSource draws each slot opening from the recorded arrivals with probability weight, and from the base source otherwise
+type blendedSource struct {
+	CurveSource
+	base     TimeSampler
+	observed []float64
+	weight   float64
+}
+
+func (src *blendedSource) OpenSlots(target int, minVal int, intervalLength int64, seed int64) ([]OpenSlots, error) {
+	n, err := slotsToOpen(target, minVal)
+	if err != nil {
+		return nil, err
+	}
+	times, err := src.SampleTimes(n, intervalLength, seed)
+	if err != nil {
+		return nil, err
+	}
+	return openSlotsFromTimes(times, minVal), nil
+}
+
+func (src *blendedSource) SampleTimes(n int, intervalLength int64, seed int64) ([]int, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("number of sample times must not be negative: %d", n)
+	}
+	r := rand.New(rand.NewSource(seed))
+
+	samples := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		if r.Float64() < src.weight {
+			share := src.observed[r.Intn(len(src.observed))]
+			samples = append(samples, int(share*float64(intervalLength)))
+		}
+	}
+
+	baseSamples, err := src.base.SampleTimes(n-len(samples), intervalLength, r.Int63())
+	if err != nil {
+		return nil, err
+	}
+	samples = append(samples, baseSamples...)
+	sort.Ints(samples)
+	return samples, nil
+}
+
+// setAdaptive records how many recorded arrivals were blended into the curve, with which weight
+func (c *SlotCurve) setAdaptive(observedArrivals int, weight float64) {
+	if observedArrivals < 1 {
+		return
+	}
+	c.ObservedArrivals = observedArrivals
+	c.AdaptiveWeight = weight
+}
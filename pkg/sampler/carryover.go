@@ -0,0 +1,81 @@
+package sampler
+
+import (
+	"math"
+	"time"
+
+	"github.com/coneno/logger"
+)
+
+// CarryOverPolicy moves unused slots of an interval to the next one, a zero Fraction disables it
+type CarryOverPolicy struct {
+	Fraction float64 // share of the unused slots (target without carried slots, minus confirmed) added to the next interval
+	Max      int     // upper limit of carried slots per interval (per stratum with strata), 0 for no limit
+}
+
+// WithCarryOver makes the sampler add unused slots of the previous interval to new curves drawn from the sample file
+func WithCarryOver(policy CarryOverPolicy) Option {
+	return func(s *Sampler) {
+		s.carryOver = policy
+	}
+}
+
+// CarryOverTo computes the slots carried over from the previous interval to the one starting at intervalStart, by stratum key ("" without strata).
+// Nothing is carried over if the previous interval has no curve or isn't over yet.
+func (s *Sampler) CarryOverTo(intervalStart time.Time) map[string]int {
+	carried := map[string]int{}
+	if s.carryOver.Fraction <= 0 {
+		return carried
+	}
+
+	prevStart := s.interval.IntervalStartAt(intervalStart.Add(-time.Second))
+	prevEnd := s.interval.IntervalEnd(prevStart)
+	if prevEnd.After(s.now()) {
+		return carried
+	}
+	prev, err := s.dbService.LoadLatestSlotCurve(s.instanceID, prevStart.Unix())
+	if err != nil {
+		logger.Debug.Printf("no slot curve of the previous interval to carry over slots from: %v", err)
+		return carried
+	}
+	confirmed, err := s.dbService.GetConfirmedSlotsCountPerStratum(s.instanceID, prevStart.Unix(), prevEnd.Unix())
+	if err != nil {
+		logger.Error.Printf("error when counting confirmed slots of the previous interval: %v", err)
+		return carried
+	}
+
+	if !s.Stratified() {
+		var total int64
+		for _, count := range confirmed {
+			total += count
+		}
+		carried[""] = s.carryOver.slots(prev.MaxTarget() - prev.CarriedOver - int(total))
+		return carried
+	}
+	// unused slots of a stratum are only carried over to the same stratum
+	for _, st := range prev.Strata {
+		unused := SlotCurve{OpenSlots: st.OpenSlots}.MaxTarget() - st.CarriedOver - int(confirmed[st.Key])
+		carried[st.Key] = s.carryOver.slots(unused)
+	}
+	return carried
+}
+
+// appliedCarryOver returns how many of the carried slots are part of a curve drawn for target slots (carried slots included).
+// Sources with a fixed curve ignore the target, and with it the carried slots.
+func appliedCarryOver(curve SlotCurve, target int, carried int) int {
+	if carried <= 0 || curve.MaxTarget() != target {
+		return 0
+	}
+	return carried
+}
+
+func (p CarryOverPolicy) slots(unused int) int {
+	if unused <= 0 {
+		return 0
+	}
+	n := int(math.Floor(float64(unused) * p.Fraction))
+	if p.Max > 0 && n > p.Max {
+		n = p.Max
+	}
+	return n
+}
@@ -0,0 +1,76 @@
+package sampler
+
+import (
+	"testing"
+	"time"
+)
+
+// savePreviousCurve stores curve as the slot curve of the interval before the current one of s
+func savePreviousCurve(t *testing.T, s *Sampler, curve SlotCurve) {
+	t.Helper()
+	curve.IntervalStart = s.interval.IntervalStartAt(s.IntervalStartNow().Add(-time.Second)).Unix()
+	if _, err := s.dbService.SaveNewSlotCurve(s.instanceID, curve); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCarryOverExcludesEarlierCarriedSlots(t *testing.T) {
+	s := newTestSampler(newTestSource(t), WithCarryOver(CarryOverPolicy{Fraction: 1}))
+	savePreviousCurve(t, s, SlotCurve{
+		OpenSlots:   []OpenSlots{{T: 0, Value: 5}, {T: 100, Value: 60}},
+		CarriedOver: 10,
+	})
+
+	// nothing was confirmed, so the drawn target of 50 is unused, but not the 10 slots carried over to it
+	if carried := s.CarryOverTo(s.IntervalStartNow()); carried[""] != 50 {
+		t.Errorf("expected 50 carried slots, got %d", carried[""])
+	}
+}
+
+func TestCarryOverPerStratumExcludesEarlierCarriedSlots(t *testing.T) {
+	strata := []StratumConfig{
+		{Key: "young", TargetSamples: 20, OpenSlotsAtStart: 2},
+		{Key: "old", TargetSamples: 30, OpenSlotsAtStart: 3},
+	}
+	s := newTestSampler(newTestSource(t), WithStrata(strata), WithCarryOver(CarryOverPolicy{Fraction: 0.5}))
+	savePreviousCurve(t, s, SlotCurve{
+		OpenSlots: []OpenSlots{{T: 0, Value: 5}, {T: 100, Value: 58}},
+		Strata: []StratumCurve{
+			{Key: "young", OpenSlots: []OpenSlots{{T: 0, Value: 2}, {T: 100, Value: 28}}, CarriedOver: 8},
+			{Key: "old", OpenSlots: []OpenSlots{{T: 0, Value: 3}, {T: 100, Value: 30}}},
+		},
+		CarriedOver: 8,
+	})
+
+	carried := s.CarryOverTo(s.IntervalStartNow())
+	if carried["young"] != 10 || carried["old"] != 15 {
+		t.Errorf("expected 10 / 15 carried slots, got %v", carried)
+	}
+}
+
+func TestDrawSlotCurveRecordsAppliedCarryOver(t *testing.T) {
+	intervalStart := time.Date(2025, time.March, 3, 0, 0, 0, 0, time.UTC)
+
+	s := newTestSampler(newTestSource(t))
+	curve, err := s.DrawSlotCurve(50, 5, intervalStart, 42, map[string]int{"": 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curve.MaxTarget() != 57 || curve.CarriedOver != 7 {
+		t.Errorf("expected target 57 with 7 carried slots, got %d / %d", curve.MaxTarget(), curve.CarriedOver)
+	}
+
+	// a fixed curve ignores the target, so the carried slots are not part of it
+	src, err := NewJSONCurveSource(writeTestFile(t, `{ "openSlots": [{ "t": 0, "value": 5 }, { "t": 100, "value": 57 }] }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = newTestSampler(src)
+	curve, err = s.DrawSlotCurve(50, 5, intervalStart, 42, map[string]int{"": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curve.CarriedOver != 0 {
+		t.Errorf("expected no carried slots with a fixed curve, got %d", curve.CarriedOver)
+	}
+}
@@ -0,0 +1,82 @@
+package sampler
+
+import (
+	"fmt"
+	"time"
+)
+
+// EligibilityRules restrict which participants can be selected, zero values disable a rule
+type EligibilityRules struct {
+	MinWeeksSinceLastSwab int        // weeks after a confirmed swab before the participant can be selected again
+	MaxSwabsPerSeason     int        // confirmed swabs per participant since the start of the season
+	MaxDeclines           int        // participants who declined this many invitations are not selected anymore
+	SeasonStartMonth      time.Month // first day of the season, e.g. October 1st
+	SeasonStartDay        int
+}
+
+// ParticipantSlotStats summarises the earlier slots of a participant
+type ParticipantSlotStats struct {
+	LastConfirmedAt   int64 // 0 if the participant never confirmed
+	ConfirmedInSeason int
+	Declines          int
+}
+
+// IneligibleError tells why a participant can't be selected
+type IneligibleError struct {
+	Reason string
+}
+
+func (e *IneligibleError) Error() string {
+	return "participant is not eligible: " + e.Reason
+}
+
+// WithEligibilityRules makes the sampler check the rules before reserving a slot
+func WithEligibilityRules(rules EligibilityRules) Option {
+	return func(s *Sampler) {
+		s.eligibility = rules
+	}
+}
+
+func (r EligibilityRules) active() bool {
+	return r.MinWeeksSinceLastSwab > 0 || r.MaxSwabsPerSeason > 0 || r.MaxDeclines > 0
+}
+
+// SeasonStartAt returns the start of the season that contains t
+func (r EligibilityRules) SeasonStartAt(t time.Time) time.Time {
+	start := time.Date(t.Year(), r.SeasonStartMonth, r.SeasonStartDay, 0, 0, 0, 0, t.Location())
+	if start.After(t) {
+		start = start.AddDate(-1, 0, 0)
+	}
+	return start
+}
+
+// Check returns an *IneligibleError if one of the rules excludes the participant at time now
+func (r EligibilityRules) Check(stats ParticipantSlotStats, now time.Time) error {
+	if r.MinWeeksSinceLastSwab > 0 && stats.LastConfirmedAt > 0 {
+		eligibleFrom := time.Unix(stats.LastConfirmedAt, 0).AddDate(0, 0, 7*r.MinWeeksSinceLastSwab)
+		if now.Before(eligibleFrom) {
+			return &IneligibleError{Reason: fmt.Sprintf("last swab less than %d weeks ago", r.MinWeeksSinceLastSwab)}
+		}
+	}
+	if r.MaxSwabsPerSeason > 0 && stats.ConfirmedInSeason >= r.MaxSwabsPerSeason {
+		return &IneligibleError{Reason: fmt.Sprintf("already %d swabs this season", stats.ConfirmedInSeason)}
+	}
+	if r.MaxDeclines > 0 && stats.Declines >= r.MaxDeclines {
+		return &IneligibleError{Reason: fmt.Sprintf("declined %d invitations", stats.Declines)}
+	}
+	return nil
+}
+
+// CheckEligibility applies the eligibility rules to the participant's earlier slots.
+// Returns an *IneligibleError if the participant can't be selected.
+func (s *Sampler) CheckEligibility(participantID string) error {
+	if !s.eligibility.active() {
+		return nil
+	}
+	now := s.now().In(s.interval.Location)
+	stats, err := s.dbService.GetParticipantSlotStats(s.instanceID, participantID, s.eligibility.SeasonStartAt(now).Unix())
+	if err != nil {
+		return err
+	}
+	return s.eligibility.Check(stats, now)
+}
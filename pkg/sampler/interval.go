@@ -0,0 +1,131 @@
+package sampler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	INTERVAL_DAILY    = "daily"
+	INTERVAL_WEEKLY   = "weekly"
+	INTERVAL_BIWEEKLY = "biweekly"
+	INTERVAL_MONTHLY  = "monthly"
+)
+
+// IntervalConfig defines the length and alignment of the sampling intervals
+type IntervalConfig struct {
+	Length       string         // one of "daily", "weekly", "biweekly" or "monthly"
+	StartWeekday time.Weekday   // first day of weekly and biweekly intervals
+	StartHour    int            // hour of the day (0-23) at which an interval starts
+	Location     *time.Location // timezone used to align the interval start
+	Anchor       time.Time      // any date in the first week of a biweekly interval, to fix which weeks are even
+	SampleLength time.Duration  // time span covered by the sample file's time axis, scaled to the actual interval length
+}
+
+// DefaultIntervalConfig returns the Monday aligned weekly interval the sampler has always used
+func DefaultIntervalConfig() IntervalConfig {
+	return IntervalConfig{
+		Length:       INTERVAL_WEEKLY,
+		StartWeekday: time.Monday,
+		StartHour:    0,
+		Location:     time.Local,
+		Anchor:       time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		SampleLength: 7 * 24 * time.Hour,
+	}
+}
+
+func (c IntervalConfig) Validate() error {
+	switch c.Length {
+	case INTERVAL_DAILY, INTERVAL_WEEKLY, INTERVAL_BIWEEKLY, INTERVAL_MONTHLY:
+	default:
+		return fmt.Errorf("unknown interval length '%s', expected one of daily, weekly, biweekly or monthly", c.Length)
+	}
+	if c.StartHour < 0 || c.StartHour > 23 {
+		return fmt.Errorf("interval start hour must be between 0 and 23, got %d", c.StartHour)
+	}
+	if c.Location == nil {
+		return errors.New("interval timezone must be set")
+	}
+	if c.SampleLength <= 0 {
+		return errors.New("sample length must be positive")
+	}
+	return nil
+}
+
+// IntervalStartAt returns the start of the interval that contains t
+func (c IntervalConfig) IntervalStartAt(t time.Time) time.Time {
+	t = t.In(c.Location)
+	year, month, day := t.Date()
+
+	switch c.Length {
+	case INTERVAL_DAILY:
+		start := time.Date(year, month, day, c.StartHour, 0, 0, 0, c.Location)
+		if start.After(t) {
+			start = start.AddDate(0, 0, -1)
+		}
+		return start
+	case INTERVAL_MONTHLY:
+		start := time.Date(year, month, 1, c.StartHour, 0, 0, 0, c.Location)
+		if start.After(t) {
+			start = start.AddDate(0, -1, 0)
+		}
+		return start
+	case INTERVAL_BIWEEKLY:
+		start := c.weekStartAt(t)
+		anchor := c.weekStartAt(time.Date(c.Anchor.Year(), c.Anchor.Month(), c.Anchor.Day(), 23, 59, 0, 0, c.Location))
+		if weeks := daysBetween(anchor, start) / 7; weeks%2 != 0 {
+			start = start.AddDate(0, 0, -7)
+		}
+		return start
+	default:
+		return c.weekStartAt(t)
+	}
+}
+
+// IntervalEnd returns the end of the interval that begins at start, which is the start of the next interval
+func (c IntervalConfig) IntervalEnd(start time.Time) time.Time {
+	start = start.In(c.Location)
+	switch c.Length {
+	case INTERVAL_DAILY:
+		return start.AddDate(0, 0, 1)
+	case INTERVAL_BIWEEKLY:
+		return start.AddDate(0, 0, 14)
+	case INTERVAL_MONTHLY:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 7)
+	}
+}
+
+func (c IntervalConfig) weekStartAt(t time.Time) time.Time {
+	year, month, day := t.Date()
+	start := time.Date(year, month, day, c.StartHour, 0, 0, 0, c.Location)
+	offset := (int(start.Weekday()) - int(c.StartWeekday) + 7) % 7
+	start = start.AddDate(0, 0, -offset)
+	if start.After(t) {
+		start = start.AddDate(0, 0, -7)
+	}
+	return start
+}
+
+// daysBetween counts calendar days from a to b, independent of DST changes in between
+func daysBetween(a time.Time, b time.Time) int {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	da := time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)
+	db := time.Date(by, bm, bd, 0, 0, 0, 0, time.UTC)
+	return int(db.Sub(da).Hours() / 24)
+}
+
+// ParseWeekday parses an English weekday name such as "monday" or "Mon"
+func ParseWeekday(s string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := d.String()
+		if strings.EqualFold(s, name) || strings.EqualFold(s, name[:3]) {
+			return d, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("unknown weekday '%s'", s)
+}
@@ -0,0 +1,124 @@
+package sampler
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // tests use Europe/Amsterdam also where the system has no timezone database
+)
+
+func TestIntervalStartAtAndEnd(t *testing.T) {
+	ams, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(year int, month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, 0, ams)
+	}
+	config := func(length string, weekday time.Weekday, hour int, anchor time.Time) IntervalConfig {
+		return IntervalConfig{
+			Length:       length,
+			StartWeekday: weekday,
+			StartHour:    hour,
+			Location:     ams,
+			Anchor:       anchor,
+			SampleLength: 7 * 24 * time.Hour,
+		}
+	}
+	anchor := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC) // a Monday
+
+	tests := []struct {
+		name      string
+		conf      IntervalConfig
+		t         time.Time
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{"weekly mid week", config(INTERVAL_WEEKLY, time.Monday, 0, anchor), at(2025, 3, 5, 12, 0, 0), at(2025, 3, 3, 0, 0, 0), at(2025, 3, 10, 0, 0, 0)},
+		{"weekly at the start", config(INTERVAL_WEEKLY, time.Monday, 0, anchor), at(2025, 3, 3, 0, 0, 0), at(2025, 3, 3, 0, 0, 0), at(2025, 3, 10, 0, 0, 0)},
+		{"weekly just before the start", config(INTERVAL_WEEKLY, time.Monday, 0, anchor), at(2025, 3, 2, 23, 59, 59), at(2025, 2, 24, 0, 0, 0), at(2025, 3, 3, 0, 0, 0)},
+		{"weekly on Sunday 6:00, before the start hour", config(INTERVAL_WEEKLY, time.Sunday, 6, anchor), at(2025, 3, 9, 5, 0, 0), at(2025, 3, 2, 6, 0, 0), at(2025, 3, 9, 6, 0, 0)},
+		{"weekly on Sunday 6:00, at the start hour", config(INTERVAL_WEEKLY, time.Sunday, 6, anchor), at(2025, 3, 9, 6, 0, 0), at(2025, 3, 9, 6, 0, 0), at(2025, 3, 16, 6, 0, 0)},
+		{"weekly with DST start", config(INTERVAL_WEEKLY, time.Monday, 0, anchor), at(2025, 3, 30, 12, 0, 0), at(2025, 3, 24, 0, 0, 0), at(2025, 3, 31, 0, 0, 0)},
+		{"weekly with DST end", config(INTERVAL_WEEKLY, time.Monday, 0, anchor), at(2025, 10, 26, 12, 0, 0), at(2025, 10, 20, 0, 0, 0), at(2025, 10, 27, 0, 0, 0)},
+		{"daily before the start hour", config(INTERVAL_DAILY, time.Monday, 6, anchor), at(2025, 3, 5, 3, 0, 0), at(2025, 3, 4, 6, 0, 0), at(2025, 3, 5, 6, 0, 0)},
+		{"daily with DST start", config(INTERVAL_DAILY, time.Monday, 6, anchor), at(2025, 3, 29, 12, 0, 0), at(2025, 3, 29, 6, 0, 0), at(2025, 3, 30, 6, 0, 0)},
+		{"biweekly in an odd week since the anchor", config(INTERVAL_BIWEEKLY, time.Monday, 0, anchor), at(2025, 3, 5, 12, 0, 0), at(2025, 2, 24, 0, 0, 0), at(2025, 3, 10, 0, 0, 0)},
+		{"biweekly in an even week since the anchor", config(INTERVAL_BIWEEKLY, time.Monday, 0, anchor), at(2025, 3, 12, 12, 0, 0), at(2025, 3, 10, 0, 0, 0), at(2025, 3, 24, 0, 0, 0)},
+		{"biweekly with the anchor mid week", config(INTERVAL_BIWEEKLY, time.Monday, 0, time.Date(2024, time.January, 3, 0, 0, 0, 0, time.UTC)), at(2025, 3, 5, 12, 0, 0), at(2025, 2, 24, 0, 0, 0), at(2025, 3, 10, 0, 0, 0)},
+		{"biweekly with the anchor after t, even", config(INTERVAL_BIWEEKLY, time.Monday, 0, time.Date(2026, time.January, 5, 0, 0, 0, 0, time.UTC)), at(2025, 3, 5, 12, 0, 0), at(2025, 3, 3, 0, 0, 0), at(2025, 3, 17, 0, 0, 0)},
+		{"biweekly with the anchor after t, odd", config(INTERVAL_BIWEEKLY, time.Monday, 0, time.Date(2025, time.December, 29, 0, 0, 0, 0, time.UTC)), at(2025, 3, 5, 12, 0, 0), at(2025, 2, 24, 0, 0, 0), at(2025, 3, 10, 0, 0, 0)},
+		{"monthly with DST start", config(INTERVAL_MONTHLY, time.Monday, 0, anchor), at(2025, 3, 31, 23, 0, 0), at(2025, 3, 1, 0, 0, 0), at(2025, 4, 1, 0, 0, 0)},
+		{"monthly just before the start", config(INTERVAL_MONTHLY, time.Monday, 0, anchor), at(2025, 2, 28, 23, 59, 59), at(2025, 2, 1, 0, 0, 0), at(2025, 3, 1, 0, 0, 0)},
+		{"monthly before the start hour", config(INTERVAL_MONTHLY, time.Monday, 6, anchor), at(2025, 3, 1, 5, 0, 0), at(2025, 2, 1, 6, 0, 0), at(2025, 3, 1, 6, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := tt.conf.IntervalStartAt(tt.t)
+			if !start.Equal(tt.wantStart) {
+				t.Fatalf("expected start %s, got %s", tt.wantStart, start)
+			}
+			end := tt.conf.IntervalEnd(start)
+			if !end.Equal(tt.wantEnd) {
+				t.Fatalf("expected end %s, got %s", tt.wantEnd, end)
+			}
+			// consecutive intervals line up without gaps
+			if next := tt.conf.IntervalStartAt(end); !next.Equal(end) {
+				t.Errorf("next interval starts at %s instead of %s", next, end)
+			}
+			if last := tt.conf.IntervalStartAt(end.Add(-time.Second)); !last.Equal(start) {
+				t.Errorf("last second of the interval belongs to the interval starting at %s", last)
+			}
+		})
+	}
+}
+
+func TestIntervalLengthWithDST(t *testing.T) {
+	ams, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := DefaultIntervalConfig()
+	conf.Location = ams
+
+	tests := []struct {
+		t    time.Time
+		want time.Duration
+	}{
+		{time.Date(2025, time.March, 5, 12, 0, 0, 0, ams), 168 * time.Hour},
+		{time.Date(2025, time.March, 30, 12, 0, 0, 0, ams), 167 * time.Hour},
+		{time.Date(2025, time.October, 26, 12, 0, 0, 0, ams), 169 * time.Hour},
+	}
+	for _, tt := range tests {
+		start := conf.IntervalStartAt(tt.t)
+		if got := conf.IntervalEnd(start).Sub(start); got != tt.want {
+			t.Errorf("%s: expected interval length %s, got %s", tt.t, tt.want, got)
+		}
+	}
+}
+
+func TestSampleLengthIsScaledToTheInterval(t *testing.T) {
+	ams, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := DefaultIntervalConfig()
+	conf.Length = INTERVAL_MONTHLY
+	conf.Location = ams
+
+	// one sample at half of the sample length, which is a week
+	src, err := NewSampleFileSource(writeTestFile(t, "id,time\n1,5040\n"), time.Minute, conf.SampleLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, month := range []time.Month{time.February, time.March, time.April} {
+		start := conf.IntervalStartAt(time.Date(2025, month, 10, 0, 0, 0, 0, ams))
+		length := conf.IntervalEnd(start).Unix() - start.Unix()
+		times, err := src.SampleTimes(1, length, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := int64(times[0]) - length/2; diff < -1 || diff > 0 {
+			t.Errorf("%s: expected the sample at %d (half of the month), got %d", month, length/2, times[0])
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package sampler
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrNoSlotCurve = errors.New("no slot curve for this interval")
+
+// MemoryDBService is a SamplerDBService that keeps everything in memory, used to simulate the sampler offline
+type MemoryDBService struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	curves   []SlotCurve
+	slots    []memorySlot
+	arrivals []RecordedArrival
+	state    SamplerState
+}
+
+type memorySlot struct {
+	Time          int64
+	IntervalStart int64
+	Stratum       string
+	ParticipantID string
+}
+
+// NewMemoryDBService creates an empty store, reservation times are taken from now
+func NewMemoryDBService(now func() time.Time) *MemoryDBService {
+	return &MemoryDBService{now: now}
+}
+
+func (m *MemoryDBService) LoadLatestSlotCurve(instanceID string, intervalStart int64) (res SlotCurve, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := false
+	for _, c := range m.curves {
+		if c.IntervalStart == intervalStart && (!found || c.Version > res.Version) {
+			res = c
+			found = true
+		}
+	}
+	if !found {
+		return res, ErrNoSlotCurve
+	}
+	return res, nil
+}
+
+func (m *MemoryDBService) SaveNewSlotCurve(instanceID string, obj SlotCurve) (res SlotCurve, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj.Version = 1
+	for _, c := range m.curves {
+		if c.IntervalStart == obj.IntervalStart && c.Version >= obj.Version {
+			obj.Version = c.Version + 1
+		}
+	}
+	obj.CreatedAt = m.now().Unix()
+	m.curves = append(m.curves, obj)
+	return obj, nil
+}
+
+func (m *MemoryDBService) GetUsedSlotsCountSince(instanceID string, ref int64) (count int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, slot := range m.slots {
+		if slot.Time > ref {
+			count += 1
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryDBService) GetUsedSlotsCountPerStratumSince(instanceID string, ref int64) (counts map[string]int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts = map[string]int64{}
+	for _, slot := range m.slots {
+		if slot.Time > ref {
+			counts[slot.Stratum] += 1
+		}
+	}
+	return counts, nil
+}
+
+func (m *MemoryDBService) ReserveSlot(instanceID string, participantID string, intervalStart int64, stratum string, target int) (reserved bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	used := 0
+	for _, slot := range m.slots {
+		// slots are never confirmed or cancelled here, so every slot is an open reservation
+		if slot.ParticipantID == participantID {
+			return true, nil
+		}
+		if slot.IntervalStart == intervalStart && slot.Stratum == stratum {
+			used += 1
+		}
+	}
+	if used >= target {
+		return false, nil
+	}
+
+	m.slots = append(m.slots, memorySlot{
+		Time:          m.now().Unix(),
+		IntervalStart: intervalStart,
+		Stratum:       stratum,
+		ParticipantID: participantID,
+	})
+	return true, nil
+}
+
+// GetParticipantSlotStats returns empty stats, as slots are never confirmed or declined here
+func (m *MemoryDBService) GetParticipantSlotStats(instanceID string, participantID string, seasonStart int64) (stats ParticipantSlotStats, err error) {
+	return stats, nil
+}
+
+// GetConfirmedSlotsCountPerStratum returns no counts, as slots are never confirmed here
+func (m *MemoryDBService) GetConfirmedSlotsCountPerStratum(instanceID string, from int64, until int64) (counts map[string]int64, err error) {
+	return map[string]int64{}, nil
+}
+
+func (m *MemoryDBService) SaveArrival(instanceID string, arrival RecordedArrival) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.arrivals = append(m.arrivals, arrival)
+	return nil
+}
+
+func (m *MemoryDBService) FindArrivalTimes(instanceID string, from int64, until int64) (times []int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	times = []int64{}
+	for _, a := range m.arrivals {
+		if a.Time >= from && a.Time < until {
+			times = append(times, a.Time)
+		}
+	}
+	return times, nil
+}
+
+func (m *MemoryDBService) LoadSamplerState(instanceID string) (state SamplerState, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.state, nil
+}
+
+func (m *MemoryDBService) SaveSamplerState(instanceID string, state SamplerState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state = state
+	return nil
+}
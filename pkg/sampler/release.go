@@ -0,0 +1,97 @@
+package sampler
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	SLOT_RELEASE_STEP   = "step"   // all slots of a point open at its time
+	SLOT_RELEASE_LINEAR = "linear" // slots open one by one between the previous point and their point
+)
+
+// number of upcoming slot openings in the sampler infos
+const nextOpeningsForecast = 5
+
+// WithSlotRelease sets how slots of new curves open between the points of the curve, step if empty
+func WithSlotRelease(release string) Option {
+	return func(s *Sampler) {
+		s.release = release
+	}
+}
+
+// ValidateSlotRelease checks that release is a known slot release mode
+func ValidateSlotRelease(release string) error {
+	switch release {
+	case SLOT_RELEASE_STEP, SLOT_RELEASE_LINEAR:
+		return nil
+	default:
+		return fmt.Errorf("unknown slot release mode '%s', expected step or linear", release)
+	}
+}
+
+// nextOpeningIndex returns the index of the first point of the curve after currentT seconds since the interval start
+func (c SlotCurve) nextOpeningIndex(currentT int64) int {
+	return sort.Search(len(c.OpenSlots), func(i int) bool {
+		return int64(c.OpenSlots[i].T) > currentT
+	})
+}
+
+// NextOpenings forecasts the next n times after unix time t at which slots open, as seconds since the interval start
+// with the number of open slots from then on. Empty if all slots of the curve are open.
+func (c SlotCurve) NextOpenings(t int64, n int) []OpenSlots {
+	if len(c.Strata) > 0 {
+		return c.nextStrataOpenings(t, n)
+	}
+	openings := []OpenSlots{}
+	i := c.nextOpeningIndex(t - c.IntervalStart)
+	value := c.TargetAt(t)
+	for ; i < len(c.OpenSlots) && len(openings) < n; i++ {
+		next := c.OpenSlots[i]
+		if c.Release != SLOT_RELEASE_LINEAR || i == 0 {
+			if next.Value > value {
+				openings = append(openings, next)
+				value = next.Value
+			}
+			continue
+		}
+
+		prev := c.OpenSlots[i-1]
+		length := int64(next.T - prev.T)
+		delta := int64(next.Value - prev.Value)
+		for value < next.Value && len(openings) < n {
+			value += 1
+			// first second at which the value-th slot is open
+			at := int(int64(prev.T) + (int64(value-prev.Value)*length+delta-1)/delta)
+			if len(openings) > 0 && openings[len(openings)-1].T == at {
+				openings[len(openings)-1].Value = value
+				continue
+			}
+			openings = append(openings, OpenSlots{T: at, Value: value})
+		}
+	}
+	return openings
+}
+
+// nextStrataOpenings combines the next openings of all strata, with the sum of the strata's targets
+func (c SlotCurve) nextStrataOpenings(t int64, n int) []OpenSlots {
+	times := []int{}
+	for _, st := range c.Strata {
+		for _, o := range c.stratumCurve(st).NextOpenings(t, n) {
+			times = append(times, o.T)
+		}
+	}
+	sort.Ints(times)
+
+	openings := []OpenSlots{}
+	for i, at := range times {
+		if len(openings) >= n {
+			break
+		}
+		if i > 0 && at == times[i-1] {
+			continue
+		}
+		openings = append(openings, OpenSlots{T: at, Value: c.TargetAt(c.IntervalStart + int64(at))})
+	}
+	return openings
+}
@@ -0,0 +1,191 @@
+package sampler
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestTargetAt(t *testing.T) {
+	// relative to the interval start: 2 slots open from 10, 3 at 100, 8 at 110, flat until 200, 10 at 300
+	openSlots := []OpenSlots{{T: 10, Value: 2}, {T: 100, Value: 3}, {T: 110, Value: 8}, {T: 200, Value: 8}, {T: 300, Value: 10}}
+	tests := []struct {
+		name       string
+		t          int64
+		wantStep   int
+		wantLinear int
+	}{
+		{"before the interval", -5, 2, 2},
+		{"before the first point", 0, 2, 2},
+		{"at the first point", 10, 2, 2},
+		{"between points, rounded down", 55, 2, 2},
+		{"one second before a point", 99, 2, 2},
+		{"at a point", 100, 3, 3},
+		{"burst of 5 slots in 10 seconds", 105, 3, 5},
+		{"one second before the burst ends", 109, 3, 7},
+		{"at the end of the burst", 110, 8, 8},
+		{"flat segment", 150, 8, 8},
+		{"last segment", 250, 8, 9},
+		{"at the last point", 300, 10, 10},
+		{"after the last point", 5000, 10, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := SlotCurve{IntervalStart: 1000, OpenSlots: openSlots}
+			linear := SlotCurve{IntervalStart: 1000, OpenSlots: openSlots, Release: SLOT_RELEASE_LINEAR}
+			if got := step.TargetAt(1000 + tt.t); got != tt.wantStep {
+				t.Errorf("step: expected %d, got %d", tt.wantStep, got)
+			}
+			if got := linear.TargetAt(1000 + tt.t); got != tt.wantLinear {
+				t.Errorf("linear: expected %d, got %d", tt.wantLinear, got)
+			}
+		})
+	}
+	if got := (SlotCurve{IntervalStart: 1000}).TargetAt(1500); got != 0 {
+		t.Errorf("expected no open slots without curve, got %d", got)
+	}
+}
+
+func TestTargetAtMatchesLinearScan(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	openSlots := []OpenSlots{{T: 0, Value: 3}}
+	for i := 0; i < 500; i++ {
+		last := openSlots[len(openSlots)-1]
+		openSlots = append(openSlots, OpenSlots{T: last.T + 1 + r.Intn(100), Value: last.Value + r.Intn(3)})
+	}
+	c := SlotCurve{IntervalStart: 1000, OpenSlots: openSlots}
+	for i := 0; i < 1000; i++ {
+		currentT := int64(r.Intn(openSlots[len(openSlots)-1].T + 100))
+		want := openSlots[0].Value
+		for _, o := range openSlots {
+			if int64(o.T) > currentT {
+				break
+			}
+			want = o.Value
+		}
+		if got := c.TargetAt(1000 + currentT); got != want {
+			t.Fatalf("at %d: expected %d, got %d", currentT, want, got)
+		}
+	}
+}
+
+func TestNextOpenings(t *testing.T) {
+	tests := []struct {
+		name      string
+		openSlots []OpenSlots
+		release   string
+		t         int64
+		n         int
+		want      []OpenSlots
+	}{
+		{
+			name:      "step",
+			openSlots: []OpenSlots{{T: 0, Value: 2}, {T: 100, Value: 3}, {T: 110, Value: 8}, {T: 200, Value: 8}, {T: 300, Value: 10}},
+			t:         50,
+			n:         5,
+			want:      []OpenSlots{{T: 100, Value: 3}, {T: 110, Value: 8}, {T: 300, Value: 10}},
+		},
+		{
+			name:      "step before the first point",
+			openSlots: []OpenSlots{{T: 10, Value: 2}, {T: 20, Value: 3}},
+			t:         0,
+			n:         5,
+			want:      []OpenSlots{{T: 20, Value: 3}},
+		},
+		{
+			name:      "linear one by one",
+			openSlots: []OpenSlots{{T: 0, Value: 2}, {T: 100, Value: 3}, {T: 110, Value: 8}},
+			release:   SLOT_RELEASE_LINEAR,
+			t:         50,
+			n:         4,
+			want:      []OpenSlots{{T: 100, Value: 3}, {T: 102, Value: 4}, {T: 104, Value: 5}, {T: 106, Value: 6}},
+		},
+		{
+			name:      "linear from a point",
+			openSlots: []OpenSlots{{T: 0, Value: 2}, {T: 100, Value: 3}, {T: 110, Value: 8}},
+			release:   SLOT_RELEASE_LINEAR,
+			t:         100,
+			n:         1,
+			want:      []OpenSlots{{T: 102, Value: 4}},
+		},
+		{
+			name:      "linear, rounded up to the next second",
+			openSlots: []OpenSlots{{T: 0, Value: 0}, {T: 10, Value: 3}},
+			release:   SLOT_RELEASE_LINEAR,
+			t:         0,
+			n:         5,
+			want:      []OpenSlots{{T: 4, Value: 1}, {T: 7, Value: 2}, {T: 10, Value: 3}},
+		},
+		{
+			name:      "linear, more slots than seconds are merged into the same second",
+			openSlots: []OpenSlots{{T: 0, Value: 0}, {T: 2, Value: 6}},
+			release:   SLOT_RELEASE_LINEAR,
+			t:         0,
+			n:         5,
+			want:      []OpenSlots{{T: 1, Value: 3}, {T: 2, Value: 6}},
+		},
+		{
+			name:      "linear, flat segment",
+			openSlots: []OpenSlots{{T: 0, Value: 5}, {T: 100, Value: 5}, {T: 200, Value: 6}},
+			release:   SLOT_RELEASE_LINEAR,
+			t:         10,
+			n:         5,
+			want:      []OpenSlots{{T: 200, Value: 6}},
+		},
+		{
+			name:      "all slots open",
+			openSlots: []OpenSlots{{T: 0, Value: 5}, {T: 100, Value: 6}},
+			release:   SLOT_RELEASE_LINEAR,
+			t:         100,
+			n:         5,
+			want:      []OpenSlots{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := SlotCurve{IntervalStart: 1000, OpenSlots: tt.openSlots, Release: tt.release}
+			got := c.NextOpenings(1000+tt.t, tt.n)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			// the forecast matches the target: the slots open exactly at the forecast time
+			for _, o := range got {
+				at := 1000 + int64(o.T)
+				if c.TargetAt(at) != o.Value || c.TargetAt(at-1) >= o.Value {
+					t.Errorf("forecast %+v doesn't match the targets %d / %d", o, c.TargetAt(at-1), c.TargetAt(at))
+				}
+			}
+		})
+	}
+}
+
+func TestTargetAtWithStrataIsTheSumOfTheStrata(t *testing.T) {
+	strata := []StratumCurve{
+		{Key: "a", OpenSlots: []OpenSlots{{T: 0, Value: 0}, {T: 100, Value: 10}}},
+		{Key: "b", OpenSlots: []OpenSlots{{T: 0, Value: 1}, {T: 50, Value: 2}, {T: 200, Value: 5}}},
+	}
+	wantOpenings := map[string]int{SLOT_RELEASE_STEP: 3, SLOT_RELEASE_LINEAR: 5}
+	for _, release := range []string{SLOT_RELEASE_STEP, SLOT_RELEASE_LINEAR} {
+		c := SlotCurve{IntervalStart: 1000, OpenSlots: mergeOpenSlots(strata), Strata: strata, Release: release}
+		for currentT := int64(0); currentT <= 250; currentT++ {
+			want := 0
+			for _, st := range strata {
+				want += c.stratumCurve(st).TargetAt(1000 + currentT)
+			}
+			if got := c.TargetAt(1000 + currentT); got != want {
+				t.Fatalf("%s at %d: expected %d, got %d", release, currentT, want, got)
+			}
+		}
+
+		openings := c.NextOpenings(1000+40, 5)
+		if len(openings) != wantOpenings[release] {
+			t.Fatalf("%s: expected %d openings, got %v", release, wantOpenings[release], openings)
+		}
+		for _, o := range openings {
+			at := 1000 + int64(o.T)
+			if c.TargetAt(at) != o.Value || c.TargetAt(at-1) >= o.Value {
+				t.Errorf("%s: forecast %+v doesn't match the targets %d / %d", release, o, c.TargetAt(at-1), c.TargetAt(at))
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package sampler
+
+import (
+	"sort"
+	"strconv"
+)
+
+// SlotUsage is the time span a participant held a slot
+type SlotUsage struct {
+	Time       int64 // time of the reservation
+	ReleasedAt int64 // time the slot was given back (invitation declined or expired), 0 if still held
+}
+
+// IntervalReport summarises how a sampling interval went
+type IntervalReport struct {
+	IntervalStart int64 `json:"intervalStart"`
+	IntervalEnd   int64 `json:"intervalEnd"`
+	CurveVersion  int   `json:"curveVersion"`
+	CurveVersions int   `json:"curveVersions"`
+	Target        int   `json:"target"`
+	// all reservations made in the interval, whatever their current status
+	Reservations int `json:"reservations"`
+	// reservations still waiting for the invite response
+	Reserved  int `json:"reserved"`
+	Confirmed int `json:"confirmed"`
+	Cancelled int `json:"cancelled"`
+	Expired   int `json:"expired"`
+	// seconds from the interval start until all target slots were in use, nil if that never happened
+	TimeToFill *int64 `json:"timeToFill"`
+	// share of the (elapsed) interval during which no slot was available
+	ZeroAvailableShare float64 `json:"zeroAvailableShare"`
+}
+
+// EvaluateInterval computes the time based figures of the report from the curve and the slot usage in the interval.
+// Only the part of the interval before now is evaluated.
+func EvaluateInterval(curve SlotCurve, intervalEnd int64, usages []SlotUsage, now int64) IntervalReport {
+	report := IntervalReport{
+		IntervalStart: curve.IntervalStart,
+		IntervalEnd:   intervalEnd,
+		CurveVersion:  curve.Version,
+		Target:        curve.MaxTarget(),
+	}
+
+	until := intervalEnd
+	if now < until {
+		until = now
+	}
+	if until <= curve.IntervalStart {
+		return report
+	}
+
+	// the number of available slots can only change at these times
+	times := []int64{curve.IntervalStart}
+	for _, o := range curve.OpenSlots {
+		times = append(times, curve.IntervalStart+int64(o.T))
+	}
+	for _, u := range usages {
+		times = append(times, u.Time)
+		if u.ReleasedAt > 0 {
+			times = append(times, u.ReleasedAt)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	changes := []int64{}
+	for _, t := range times {
+		if t < curve.IntervalStart || t >= until || (len(changes) > 0 && changes[len(changes)-1] == t) {
+			continue
+		}
+		changes = append(changes, t)
+	}
+
+	var zeroAvailable int64
+	for i, t := range changes {
+		next := until
+		if i+1 < len(changes) {
+			next = changes[i+1]
+		}
+
+		used := usedSlotsAt(usages, t)
+		if report.TimeToFill == nil && report.Target > 0 && used >= report.Target {
+			timeToFill := t - curve.IntervalStart
+			report.TimeToFill = &timeToFill
+		}
+		if curve.TargetAt(t)-used <= 0 {
+			zeroAvailable += next - t
+		}
+	}
+	report.ZeroAvailableShare = float64(zeroAvailable) / float64(until-curve.IntervalStart)
+	return report
+}
+
+func usedSlotsAt(usages []SlotUsage, t int64) int {
+	used := 0
+	for _, u := range usages {
+		if u.Time <= t && (u.ReleasedAt == 0 || u.ReleasedAt > t) {
+			used += 1
+		}
+	}
+	return used
+}
+
+func IntervalReportCSVHeader() []string {
+	return []string{
+		"intervalStart",
+		"intervalEnd",
+		"curveVersion",
+		"curveVersions",
+		"target",
+		"reservations",
+		"reserved",
+		"confirmed",
+		"cancelled",
+		"expired",
+		"timeToFill",
+		"zeroAvailableShare",
+	}
+}
+
+// CSVRow formats the report in the column order of IntervalReportCSVHeader, an empty timeToFill means the interval was never full
+func (r IntervalReport) CSVRow() []string {
+	timeToFill := ""
+	if r.TimeToFill != nil {
+		timeToFill = strconv.FormatInt(*r.TimeToFill, 10)
+	}
+	return []string{
+		strconv.FormatInt(r.IntervalStart, 10),
+		strconv.FormatInt(r.IntervalEnd, 10),
+		strconv.Itoa(r.CurveVersion),
+		strconv.Itoa(r.CurveVersions),
+		strconv.Itoa(r.Target),
+		strconv.Itoa(r.Reservations),
+		strconv.Itoa(r.Reserved),
+		strconv.Itoa(r.Confirmed),
+		strconv.Itoa(r.Cancelled),
+		strconv.Itoa(r.Expired),
+		timeToFill,
+		strconv.FormatFloat(r.ZeroAvailableShare, 'f', 4, 64),
+	}
+}
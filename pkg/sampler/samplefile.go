@@ -0,0 +1,94 @@
+package sampler
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrSampleFileUnreadable = errors.New("sample file can't be read")
+	ErrNoSamples            = errors.New("no samples found")
+	ErrMissingHeader        = errors.New("header row is missing")
+	ErrColumnCount          = errors.New("wrong number of columns")
+	ErrInvalidValue         = errors.New("invalid value")
+	ErrValueOutOfRange      = errors.New("value is outside of the sample length")
+)
+
+// SampleFileError tells where a sample or histogram file is wrong, Row is 0 if the whole file is concerned.
+// Err wraps one of the ErrSampleFileUnreadable, ErrNoSamples, ErrMissingHeader, ErrColumnCount, ErrInvalidValue or ErrValueOutOfRange errors.
+type SampleFileError struct {
+	Path string
+	Row  int
+	Err  error
+}
+
+func (e *SampleFileError) Error() string {
+	if e.Row > 0 {
+		return fmt.Sprintf("%s: row %d: %v", e.Path, e.Row, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *SampleFileError) Unwrap() error {
+	return e.Err
+}
+
+// readSampleCSV reads a CSV file with a header row and at least one data row. All rows must have the same number of columns, at least minColumns.
+// The returned rows don't include the header, so rows[i] is row i+2 of the file.
+func readSampleCSV(filePath string, minColumns int) ([][]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, &SampleFileError{Path: filePath, Err: fmt.Errorf("%w: %v", ErrSampleFileUnreadable, err)}
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, &SampleFileError{Path: filePath, Err: ErrNoSamples}
+	}
+	if err != nil {
+		return nil, &SampleFileError{Path: filePath, Err: fmt.Errorf("%w: %v", ErrSampleFileUnreadable, err)}
+	}
+	if len(header) < minColumns {
+		return nil, &SampleFileError{Path: filePath, Row: 1, Err: fmt.Errorf("%w: expected at least %d, got %d", ErrColumnCount, minColumns, len(header))}
+	}
+	if isNumericRow(header) {
+		return nil, &SampleFileError{Path: filePath, Row: 1, Err: ErrMissingHeader}
+	}
+
+	rows := [][]string{}
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, &SampleFileError{Path: filePath, Err: fmt.Errorf("%w: %v", ErrSampleFileUnreadable, err)}
+		}
+		if len(row) != len(header) {
+			return nil, &SampleFileError{Path: filePath, Row: len(rows) + 2, Err: fmt.Errorf("%w: expected %d like the header, got %d", ErrColumnCount, len(header), len(row))}
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) < 1 {
+		return nil, &SampleFileError{Path: filePath, Err: ErrNoSamples}
+	}
+	return rows, nil
+}
+
+// isNumericRow is true if all cells are numbers, i.e. the row is data and not a header
+func isNumericRow(row []string) bool {
+	for _, cell := range row {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(cell), 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+package sampler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, content string) string {
+	t.Helper()
+	fp := filepath.Join(t.TempDir(), "samples.csv")
+	if err := os.WriteFile(fp, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return fp
+}
+
+func TestNewSampleFileSourceErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr error
+		wantRow int
+	}{
+		{name: "empty file", content: "", wantErr: ErrNoSamples},
+		{name: "header only", content: "id,time\n", wantErr: ErrNoSamples},
+		{name: "missing header", content: "1,10\n2,20\n", wantErr: ErrMissingHeader, wantRow: 1},
+		{name: "one column", content: "time\n10\n", wantErr: ErrColumnCount, wantRow: 1},
+		{name: "row with fewer columns", content: "id,time\n1,10\n2\n", wantErr: ErrColumnCount, wantRow: 3},
+		{name: "row with more columns", content: "id,time\n1,10,x\n", wantErr: ErrColumnCount, wantRow: 2},
+		{name: "not a number", content: "id,time\n1,10\n2,ten\n", wantErr: ErrInvalidValue, wantRow: 3},
+		{name: "negative", content: "id,time\n1,-1\n", wantErr: ErrValueOutOfRange, wantRow: 2},
+		{name: "at the sample length", content: "id,time\n1,59\n2,60\n", wantErr: ErrValueOutOfRange, wantRow: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fp := writeTestFile(t, tt.content)
+			_, err := NewSampleFileSource(fp, time.Minute, time.Hour)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			var fileErr *SampleFileError
+			if !errors.As(err, &fileErr) {
+				t.Fatalf("expected *SampleFileError, got %T", err)
+			}
+			if fileErr.Row != tt.wantRow || fileErr.Path != fp {
+				t.Errorf("expected row %d of %s, got row %d of %s", tt.wantRow, fp, fileErr.Row, fileErr.Path)
+			}
+		})
+	}
+}
+
+func TestNewSampleFileSourceUnreadable(t *testing.T) {
+	_, err := NewSampleFileSource(filepath.Join(t.TempDir(), "missing.csv"), time.Minute, time.Hour)
+	if !errors.Is(err, ErrSampleFileUnreadable) {
+		t.Errorf("expected ErrSampleFileUnreadable, got %v", err)
+	}
+}
+
+func TestSampleFileSourceDrawsAllRows(t *testing.T) {
+	fp := writeTestFile(t, "id,time\n1,0\n2,59\n")
+	src, err := NewSampleFileSource(fp, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	times, err := src.SampleTimes(100, 3600, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drawn := map[int]int{}
+	for _, ts := range times {
+		drawn[ts] += 1
+	}
+	if len(drawn) != 2 || drawn[0] == 0 || drawn[59*60] == 0 {
+		t.Errorf("expected both the first and the last row to be drawn, got %v", drawn)
+	}
+}
+
+func TestNewHistogramSourceErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr error
+		wantRow int
+	}{
+		{name: "missing header", content: "0,1\n", wantErr: ErrMissingHeader, wantRow: 1},
+		{name: "hour out of range", content: "hour,share\n0,1\n24,1\n", wantErr: ErrValueOutOfRange, wantRow: 3},
+		{name: "negative share", content: "hour,share\n0,-1\n", wantErr: ErrInvalidValue, wantRow: 2},
+		{name: "all shares 0", content: "hour,share\n0,0\n1,0\n", wantErr: ErrNoSamples},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewHistogramSource(writeTestFile(t, tt.content), 24*time.Hour)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			var fileErr *SampleFileError
+			if !errors.As(err, &fileErr) || fileErr.Row != tt.wantRow {
+				t.Errorf("expected row %d, got %v", tt.wantRow, err)
+			}
+		})
+	}
+}
+
+func TestSourcesRejectTargetBelowOpenSlotsAtStart(t *testing.T) {
+	src, err := NewSampleFileSource(writeTestFile(t, "id,time\n1,0\n"), time.Minute, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule, err := NewScheduleSource(UniformSchedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range []CurveSource{src, schedule} {
+		if _, err := src.OpenSlots(5, 10, 3600, 1); !errors.Is(err, ErrInvalidTarget) {
+			t.Errorf("%s: expected ErrInvalidTarget, got %v", src.Kind(), err)
+		}
+	}
+}
+
+func TestReloadSourceKeepsSourceOfInvalidFile(t *testing.T) {
+	fp := writeTestFile(t, "id,time\n1,0\n")
+	src, err := NewSampleFileSource(fp, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestSampler(src)
+
+	if err := os.WriteFile(fp, []byte("id,time\n1,later\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := s.ReloadSource(); reloaded || !errors.Is(err, ErrInvalidValue) {
+		t.Fatalf("expected ErrInvalidValue, got %t, %v", reloaded, err)
+	}
+	if s.Source() != CurveSource(src) {
+		t.Fatal("source of the invalid file should not be used")
+	}
+
+	if err := os.WriteFile(fp, []byte("id,time\n1,30\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := s.ReloadSource(); !reloaded || err != nil {
+		t.Fatalf("expected reload of the corrected file, got %t, %v", reloaded, err)
+	}
+	openSlots, err := s.Source().OpenSlots(1, 0, 3600, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if openSlots[len(openSlots)-1].T != 1800 {
+		t.Errorf("expected the slot to open at the new sample time, got %v", openSlots)
+	}
+}
+
+func TestReloadSourceWithoutFile(t *testing.T) {
+	schedule, err := NewScheduleSource(UniformSchedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := newTestSampler(schedule).ReloadSource(); reloaded || err != nil {
+		t.Errorf("expected no reload without a file, got %t, %v", reloaded, err)
+	}
+}
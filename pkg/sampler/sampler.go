@@ -1,11 +1,9 @@
 package sampler
 
 import (
-	"encoding/csv"
+	"errors"
+	"fmt"
 	"math/rand"
-	"os"
-	"sort"
-	"strconv"
 	"time"
 
 	"github.com/coneno/logger"
@@ -14,34 +12,112 @@ import (
 func NewSampler(
 	instanceID string,
 	dbService SamplerDBService,
+	interval IntervalConfig,
+	opts ...Option,
 ) *Sampler {
-	return &Sampler{
+	s := &Sampler{
 		instanceID: instanceID,
 		dbService:  dbService,
+		interval:   interval,
+		now:        time.Now,
+		newSeed:    rand.Int63,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-func (s Sampler) openSlotTargetNow() int {
-	if len(s.SlotCurve.OpenSlots) < 1 {
-		logger.Debug.Println("slot curve is not available")
-		return 0
+// Option changes the defaults of a new sampler
+type Option func(*Sampler)
+
+// WithClock replaces time.Now, e.g. to run the sampler against a simulated time
+func WithClock(now func() time.Time) Option {
+	return func(s *Sampler) {
+		s.now = now
+	}
+}
+
+// WithSeedSource replaces the random source of the seeds for new slot curves
+func WithSeedSource(newSeed func() int64) Option {
+	return func(s *Sampler) {
+		s.newSeed = newSeed
 	}
+}
 
-	currentT := time.Now().Unix() - s.SlotCurve.IntervalStart
+// WithFixedSeed makes the sampler draw every new slot curve with the same seed
+func WithFixedSeed(seed int64) Option {
+	return WithSeedSource(func() int64 { return seed })
+}
 
-	openSlots := s.SlotCurve.OpenSlots[0].Value
-	for _, slotTarget := range s.SlotCurve.OpenSlots {
-		if int64(slotTarget.T) > currentT {
-			break
+// Curve returns a copy of the slot curve currently in use
+func (s *Sampler) Curve() SlotCurve {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.slotCurve
+}
+
+// SetCurve replaces the slot curve currently in use
+func (s *Sampler) SetCurve(curve SlotCurve) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slotCurve = curve
+}
+
+// Interval returns the interval configuration the sampler was created with
+func (s *Sampler) Interval() IntervalConfig {
+	return s.interval
+}
+
+// TargetAt returns the number of open slots at unix time t. With the linear release, the slots of a point open
+// one by one between the previous point and their point, otherwise all at once at their point.
+// With strata, it is the sum of the strata's targets.
+func (c SlotCurve) TargetAt(t int64) int {
+	if len(c.Strata) > 0 {
+		total := 0
+		for _, st := range c.Strata {
+			total += c.stratumCurve(st).TargetAt(t)
 		}
-		openSlots = slotTarget.Value
+		return total
+	}
+	if len(c.OpenSlots) < 1 {
+		return 0
+	}
+	currentT := t - c.IntervalStart
+
+	i := c.nextOpeningIndex(currentT)
+	if i == 0 {
+		return c.OpenSlots[0].Value
 	}
-	logger.Debug.Printf("Target slot count at %d: %d", currentT, openSlots)
+	prev := c.OpenSlots[i-1]
+	if c.Release != SLOT_RELEASE_LINEAR || i == len(c.OpenSlots) {
+		return prev.Value
+	}
+	next := c.OpenSlots[i]
+	return prev.Value + int(int64(next.Value-prev.Value)*(currentT-int64(prev.T))/int64(next.T-prev.T))
+}
+
+// MaxTarget is the number of slots open at the end of the interval
+func (c SlotCurve) MaxTarget() int {
+	if len(c.OpenSlots) < 1 {
+		return 0
+	}
+	return c.OpenSlots[len(c.OpenSlots)-1].Value
+}
+
+func openSlotTargetAt(curve SlotCurve, t int64) int {
+	if len(curve.OpenSlots) < 1 {
+		logger.Debug.Println("slot curve is not available")
+		return 0
+	}
+
+	openSlots := curve.TargetAt(t)
+	logger.Debug.Printf("Target slot count at %d: %d", t-curve.IntervalStart, openSlots)
 	return openSlots
 }
 
-func (s Sampler) getUsedSlotsCountNow() int {
-	count, err := s.dbService.GetUsedSlotsCountSince(s.instanceID, s.SlotCurve.IntervalStart)
+func (s *Sampler) getUsedSlotsCountNow(curve SlotCurve) int {
+	count, err := s.dbService.GetUsedSlotsCountSince(s.instanceID, curve.IntervalStart)
 	if err != nil {
 		logger.Debug.Printf("error when fetching used slot count: %v", err)
 		return 0
@@ -49,115 +125,237 @@ func (s Sampler) getUsedSlotsCountNow() int {
 	return int(count)
 }
 
-func (s Sampler) HasAvailableFreeSlots() bool {
-	openSlotsTarget := s.openSlotTargetNow()
-	usedSlots := s.getUsedSlotsCountNow()
-	availableSlots := openSlotsTarget - usedSlots
+// TryReserveSlot reserves a slot for the participant if the number of used slots is below the current target.
+// Checking and taking the slot is a single atomic operation in the DB, so concurrent calls can't exceed the target.
+// If the curve has strata, only the slots of the participant's stratum are considered.
+func (s *Sampler) TryReserveSlot(participantID string, stratum string) (bool, error) {
+	curve := s.Curve()
+	if len(curve.Strata) < 1 {
+		stratum = ""
+	} else {
+		st, ok := curve.Stratum(stratum)
+		if !ok {
+			return false, fmt.Errorf("%w: '%s'", ErrUnknownStratum, stratum)
+		}
+		curve = curve.stratumCurve(st)
+	}
 
-	return availableSlots > 0
+	openSlotsTarget := openSlotTargetAt(curve, s.now().Unix())
+	if openSlotsTarget < 1 {
+		return false, nil
+	}
+	return s.dbService.ReserveSlot(s.instanceID, participantID, curve.IntervalStart, stratum, openSlotsTarget)
 }
 
-func (s Sampler) GetSamplerInfos() SampleInfos {
-	openSlotsTarget := s.openSlotTargetNow()
-	usedSlots := s.getUsedSlotsCountNow()
+func (s *Sampler) GetSamplerInfos() SampleInfos {
+	curve := s.Curve()
+	now := s.now().Unix()
+	openSlotsTarget := openSlotTargetAt(curve, now)
+	usedSlots := s.getUsedSlotsCountNow(curve)
 	availableSlots := openSlotsTarget - usedSlots
-	currentT := time.Now().Unix() - s.SlotCurve.IntervalStart
+	currentT := now - curve.IntervalStart
 
-	maxSlots := s.SlotCurve.OpenSlots[len(s.SlotCurve.OpenSlots)-1].Value
+	maxSlots := curve.MaxTarget()
 
-	return SampleInfos{
+	infos := SampleInfos{
 		CurrentTime:     currentT,
 		OpenSlotsTarget: openSlotsTarget,
 		UsedSlots:       usedSlots,
 		AvailableSlots:  availableSlots,
 		MaxSlots:        maxSlots,
+		CurveVersion:    curve.Version,
+		NextOpenings:    curve.NextOpenings(now, nextOpeningsForecast),
+		NextBlackout:    s.NextBlackout(s.now()),
+	}
+
+	state, err := s.State()
+	if err != nil {
+		logger.Debug.Printf("error when loading sampler state: %v", err)
 	}
+	infos.State = state.State
+
+	if len(curve.Strata) > 0 {
+		counts, err := s.dbService.GetUsedSlotsCountPerStratumSince(s.instanceID, curve.IntervalStart)
+		if err != nil {
+			logger.Debug.Printf("error when fetching used slot count per stratum: %v", err)
+		}
+		for _, st := range curve.Strata {
+			c := curve.stratumCurve(st)
+			target := c.TargetAt(now)
+			used := int(counts[st.Key])
+			infos.Strata = append(infos.Strata, StratumInfos{
+				Key:             st.Key,
+				OpenSlotsTarget: target,
+				UsedSlots:       used,
+				AvailableSlots:  target - used,
+				MaxSlots:        c.MaxTarget(),
+			})
+		}
+	}
+	return infos
 }
 
+// LoadSlotCurveFromDB loads the latest version of the slot curve for the current interval
 func (s *Sampler) LoadSlotCurveFromDB() {
-	sc, err := s.dbService.LoadLatestSlotCurve(s.instanceID)
+	intervalStart := s.IntervalStartNow().Unix()
+	sc, err := s.dbService.LoadLatestSlotCurve(s.instanceID, intervalStart)
 	if err != nil {
 		logger.Debug.Printf("error when trying to load slot curve from DB: %v", err)
 		return
 	}
-	s.SlotCurve = sc
+	s.SetCurve(sc)
 }
 
-func (s Sampler) SaveSlotCurveToDB() {
-	err := s.dbService.SaveNewSlotCurve(s.instanceID, s.SlotCurve)
+func (s *Sampler) SaveSlotCurveToDB() {
+	saved, err := s.dbService.SaveNewSlotCurve(s.instanceID, s.Curve())
 	if err != nil {
 		logger.Error.Printf("unexpected error when saving slot curve to DB: %v", err)
+		return
 	}
+	s.SetCurve(saved)
 }
 
-func (s *Sampler) InitFromSampleCSV(filePath string, target int, minVal int) {
-	data := readCsvFile(filePath)[1:]
+// SaveSlotCurveVersion stores the curve as a new version of its interval's curve.
+// If the curve belongs to the current interval, the sampler starts using it immediately.
+func (s *Sampler) SaveSlotCurveVersion(curve SlotCurve) (SlotCurve, error) {
+	saved, err := s.dbService.SaveNewSlotCurve(s.instanceID, curve)
+	if err != nil {
+		return saved, err
+	}
+	if saved.IntervalStart == s.IntervalStartNow().Unix() {
+		s.SetCurve(saved)
+	}
+	return saved, nil
+}
 
-	rand.Seed(time.Now().UnixNano())
+// InitCurve draws the curve of the current interval from the curve source, including the slots carried over from the previous interval
+func (s *Sampler) InitCurve(target int, minVal int) error {
+	intervalStart := s.IntervalStartNow()
+	curve, err := s.DrawSlotCurve(target, minVal, intervalStart, s.NewSeed(), s.CarryOverTo(intervalStart))
+	if err != nil {
+		return err
+	}
+	s.SetCurve(curve)
+	return nil
+}
 
-	n := target - minVal
-	samples := make([]int, n)
-	for i := 0; i < n; i++ {
-		index := rand.Intn(len(data) - 1)
-		value, err := strconv.Atoi(data[index][1])
-		if err != nil {
-			logger.Error.Fatal("wrong value: " + err.Error())
-		}
-		samples[i] = value * 60
+// KeepLastCurve moves the curve in use to the current interval, so sampling goes on with the last good curve if no new one can be drawn.
+// Slot openings after the end of the current interval are moved to its last second. Returns false if there is no curve to keep.
+func (s *Sampler) KeepLastCurve() bool {
+	last := s.Curve()
+	if len(last.OpenSlots) < 1 {
+		return false
 	}
-	sort.Ints(samples)
 
-	openSlots := []OpenSlots{
-		{T: 0, Value: minVal},
+	intervalStart := s.IntervalStartNow()
+	intervalEnd := s.interval.IntervalEnd(intervalStart)
+	intervalLength := intervalEnd.Unix() - intervalStart.Unix()
+	curve := SlotCurve{
+		IntervalStart:    intervalStart.Unix(),
+		IntervalEnd:      intervalEnd.Unix(),
+		OpenSlots:        fitOpenSlots(last.OpenSlots, intervalLength),
+		Source:           SLOT_CURVE_SOURCE_PREVIOUS,
+		Release:          s.release,
+		TargetSamples:    last.TargetSamples,
+		OpenSlotsAtStart: last.OpenSlotsAtStart,
 	}
+	for _, st := range last.Strata {
+		st.OpenSlots = fitOpenSlots(st.OpenSlots, intervalLength)
+		st.CarriedOver = 0
+		curve.Strata = append(curve.Strata, st)
+	}
+	s.SetCurve(curve)
+	return true
+}
 
-	for _, s := range samples {
-		lastSlotOpening := openSlots[len(openSlots)-1]
-		if s == lastSlotOpening.T {
-			openSlots[len(openSlots)-1].Value += 1
-		} else {
-			openSlots = append(openSlots,
-				OpenSlots{T: s, Value: lastSlotOpening.Value + 1},
-			)
+// fitOpenSlots moves slot openings after the end of an interval of intervalLength seconds to its last second
+func fitOpenSlots(openSlots []OpenSlots, intervalLength int64) []OpenSlots {
+	fitted := []OpenSlots{}
+	for _, o := range openSlots {
+		if int64(o.T) >= intervalLength {
+			o.T = int(intervalLength - 1)
 		}
+		if len(fitted) > 0 && fitted[len(fitted)-1].T == o.T {
+			fitted[len(fitted)-1].Value = o.Value
+			continue
+		}
+		fitted = append(fitted, o)
 	}
+	return fitted
+}
 
-	s.SlotCurve = SlotCurve{
-		IntervalStart: getStartOfTheWeek(),
-		OpenSlots:     openSlots,
-	}
+// NewSeed returns a seed for drawing a new slot curve from the sampler's seed source
+func (s *Sampler) NewSeed() int64 {
+	return s.newSeed()
 }
 
-func (s Sampler) NeedsRefresh() bool {
-	sY, sW := time.Unix(s.SlotCurve.IntervalStart, 0).ISOWeek()
-	nY, nW := time.Now().ISOWeek()
-	if nY != sY || sW != nW {
-		return true
-	}
-	return false
+// IntervalStartNow returns the start of the current interval according to the sampler's clock
+func (s *Sampler) IntervalStartNow() time.Time {
+	return s.interval.IntervalStartAt(s.now())
 }
 
-func getStartOfTheWeek() int64 {
-	t := time.Now()
-	year, month, day := t.Date()
-	t = time.Date(year, month, day, 0, 0, 0, 0, time.Local)
-	for t.Weekday() != time.Monday { // iterate back to Monday
-		t = t.AddDate(0, 0, -1)
+// newSlotCurveFromSource draws a new slot curve for the interval starting at intervalStart from the source.
+// The same source, parameters and seed always result in the same curve.
+func (s *Sampler) newSlotCurveFromSource(source CurveSource, target int, minVal int, intervalStart time.Time, seed int64) (SlotCurve, error) {
+	intervalEnd := s.interval.IntervalEnd(intervalStart)
+	openSlots, err := source.OpenSlots(target, minVal, intervalEnd.Unix()-intervalStart.Unix(), seed)
+	if err != nil {
+		return SlotCurve{}, err
 	}
-	return t.Unix()
+
+	curve := SlotCurve{
+		IntervalStart: intervalStart.Unix(),
+		IntervalEnd:   intervalEnd.Unix(),
+		OpenSlots:     openSlots,
+		Release:       s.release,
+		Source:        source.Kind(),
+		SampleFile:    source.Name(),
+		Seed:          &seed,
+	}
+	// sources with a fixed curve ignore the targets
+	curve.TargetSamples = curve.MaxTarget()
+	curve.OpenSlotsAtStart = curve.TargetAt(curve.IntervalStart)
+	return curve, nil
 }
 
-func readCsvFile(filePath string) [][]string {
-	f, err := os.Open(filePath)
-	if err != nil {
-		logger.Error.Fatal("Unable to read input file "+filePath, err)
+// NewSlotCurve checks hand-crafted open slots and wraps them into a slot curve for the interval starting at intervalStart
+func (s *Sampler) NewSlotCurve(openSlots []OpenSlots, intervalStart time.Time) (SlotCurve, error) {
+	intervalEnd := s.interval.IntervalEnd(intervalStart)
+	if err := ValidateOpenSlots(openSlots, intervalEnd.Unix()-intervalStart.Unix()); err != nil {
+		return SlotCurve{}, err
 	}
-	defer f.Close()
+	return SlotCurve{
+		IntervalStart: intervalStart.Unix(),
+		IntervalEnd:   intervalEnd.Unix(),
+		OpenSlots:     openSlots,
+		Release:       s.release,
+		Source:        SLOT_CURVE_SOURCE_UPLOAD,
+	}, nil
+}
 
-	csvReader := csv.NewReader(f)
-	records, err := csvReader.ReadAll()
-	if err != nil {
-		logger.Error.Fatal("Unable to parse file as CSV for "+filePath, err)
+// ValidateOpenSlots checks that the slot openings are sorted by time, inside the interval and never decrease
+func ValidateOpenSlots(openSlots []OpenSlots, intervalLength int64) error {
+	if len(openSlots) < 1 {
+		return errors.New("open slots must not be empty")
 	}
-	return records
+	for i, o := range openSlots {
+		if o.T < 0 || int64(o.T) >= intervalLength {
+			return fmt.Errorf("open slots [%d]: t=%d is outside of the interval (0 - %d)", i, o.T, intervalLength-1)
+		}
+		if o.Value < 0 {
+			return fmt.Errorf("open slots [%d]: value must not be negative", i)
+		}
+		if i > 0 && o.T <= openSlots[i-1].T {
+			return fmt.Errorf("open slots [%d]: t=%d must be greater than the previous t", i, o.T)
+		}
+		if i > 0 && o.Value < openSlots[i-1].Value {
+			return fmt.Errorf("open slots [%d]: value %d must not be lower than the previous value", i, o.Value)
+		}
+	}
+	return nil
+}
+
+// NeedsRefresh is true if the current slot curve doesn't belong to the interval we are in now
+func (s *Sampler) NeedsRefresh() bool {
+	return s.Curve().IntervalStart != s.IntervalStartNow().Unix()
 }
@@ -0,0 +1,88 @@
+package sampler
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestSource returns a sample file source with a sample in every hour of a week
+func newTestSource(t *testing.T) CurveSource {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("id,time\n")
+	for i := 0; i < 7*24; i++ {
+		fmt.Fprintf(&b, "%d,%d\n", i, i*60+30)
+	}
+	src, err := NewSampleFileSource(writeTestFile(t, b.String()), time.Minute, 7*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func newTestSampler(src CurveSource, opts ...Option) *Sampler {
+	now := time.Date(2025, time.March, 5, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	interval := DefaultIntervalConfig()
+	interval.Location = time.UTC
+	opts = append([]Option{WithClock(clock), WithCurveSource(src)}, opts...)
+	return NewSampler("test", NewMemoryDBService(clock), interval, opts...)
+}
+
+func TestInitCurveWithFixedSeedIsReproducible(t *testing.T) {
+	src := newTestSource(t)
+
+	first := newTestSampler(src, WithFixedSeed(42))
+	if err := first.InitCurve(50, 5); err != nil {
+		t.Fatal(err)
+	}
+	second := newTestSampler(src, WithFixedSeed(42))
+	if err := second.InitCurve(50, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := first.Curve(), second.Curve()
+	if a.IntervalStart != time.Date(2025, time.March, 3, 0, 0, 0, 0, time.UTC).Unix() {
+		t.Errorf("unexpected interval start %d", a.IntervalStart)
+	}
+	if a.Seed == nil || *a.Seed != 42 {
+		t.Errorf("expected seed 42 to be stored, got %v", a.Seed)
+	}
+	if a.TargetSamples != 50 || a.OpenSlotsAtStart != 5 {
+		t.Errorf("unexpected targets %d / %d", a.TargetSamples, a.OpenSlotsAtStart)
+	}
+	if !reflect.DeepEqual(a.OpenSlots, b.OpenSlots) {
+		t.Errorf("same seed resulted in different curves:\n%v\n%v", a.OpenSlots, b.OpenSlots)
+	}
+}
+
+func TestDrawSlotCurveWithOtherSeedDiffers(t *testing.T) {
+	s := newTestSampler(newTestSource(t))
+	intervalStart := s.IntervalStartNow()
+
+	a, err := s.DrawSlotCurve(50, 5, intervalStart, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := s.DrawSlotCurve(50, 5, intervalStart, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.DrawSlotCurve(50, 5, intervalStart, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(a.OpenSlots, again.OpenSlots) {
+		t.Error("same seed resulted in different curves")
+	}
+	if reflect.DeepEqual(a.OpenSlots, b.OpenSlots) {
+		t.Error("different seeds resulted in the same curve")
+	}
+	if a.MaxTarget() != 50 || b.MaxTarget() != 50 {
+		t.Errorf("expected 50 slots at the end, got %d and %d", a.MaxTarget(), b.MaxTarget())
+	}
+}
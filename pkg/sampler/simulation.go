@@ -0,0 +1,146 @@
+package sampler
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Arrival is a simulated /is-selected call
+type Arrival struct {
+	T             int64 // seconds since the interval start
+	ParticipantID string
+}
+
+// SimulationConfig defines the curve the arrivals are replayed against
+type SimulationConfig struct {
+	Interval         IntervalConfig
+	IntervalStart    time.Time
+	Source           CurveSource
+	Release          string // slot release mode of the curve, step if empty
+	TargetSamples    int
+	OpenSlotsAtStart int
+	Seed             int64
+	Buckets          int // number of equally long parts of the interval in the distribution
+}
+
+type SimulationResult struct {
+	IntervalStart int64              `json:"intervalStart"`
+	IntervalEnd   int64              `json:"intervalEnd"`
+	Seed          int64              `json:"seed"`
+	Target        int                `json:"target"`
+	Arrivals      int                `json:"arrivals"`
+	Selected      int                `json:"selected"`   // arrivals answered with true, including repeated arrivals of selected participants
+	TurnedAway    int                `json:"turnedAway"` // arrivals answered with false
+	UsedSlots     int                `json:"usedSlots"`
+	FillRate      float64            `json:"fillRate"` // used slots / target
+	Distribution  []SimulationBucket `json:"distribution"`
+}
+
+// SimulationBucket counts the arrivals and selections in [Start, End) seconds since the interval start
+type SimulationBucket struct {
+	Start    int64 `json:"start"`
+	End      int64 `json:"end"`
+	Arrivals int   `json:"arrivals"`
+	Selected int   `json:"selected"`
+}
+
+// Simulate replays the arrivals against a slot curve drawn from the curve source, using the sampler with a simulated clock
+// and an in-memory DB. Arrivals outside of the interval are ignored.
+func Simulate(conf SimulationConfig, arrivals []Arrival) (SimulationResult, error) {
+	if conf.Buckets < 1 {
+		return SimulationResult{}, errors.New("number of buckets must be positive")
+	}
+	if conf.OpenSlotsAtStart < 0 || conf.TargetSamples < conf.OpenSlotsAtStart {
+		return SimulationResult{}, errors.New("target samples must be at least the open slots at start, which must not be negative")
+	}
+
+	intervalStart := conf.Interval.IntervalStartAt(conf.IntervalStart)
+	intervalEnd := conf.Interval.IntervalEnd(intervalStart)
+	intervalLength := intervalEnd.Unix() - intervalStart.Unix()
+
+	now := intervalStart
+	clock := func() time.Time { return now }
+	s := NewSampler("simulation", NewMemoryDBService(clock), conf.Interval, WithClock(clock), WithFixedSeed(conf.Seed), WithCurveSource(conf.Source), WithSlotRelease(conf.Release))
+	if err := s.InitCurve(conf.TargetSamples, conf.OpenSlotsAtStart); err != nil {
+		return SimulationResult{}, err
+	}
+	s.SaveSlotCurveToDB()
+
+	res := SimulationResult{
+		IntervalStart: intervalStart.Unix(),
+		IntervalEnd:   intervalEnd.Unix(),
+		Seed:          conf.Seed,
+		Target:        s.Curve().MaxTarget(),
+		Distribution:  make([]SimulationBucket, conf.Buckets),
+	}
+	for i := range res.Distribution {
+		res.Distribution[i].Start = intervalLength * int64(i) / int64(conf.Buckets)
+		res.Distribution[i].End = intervalLength * int64(i+1) / int64(conf.Buckets)
+	}
+
+	sorted := make([]Arrival, len(arrivals))
+	copy(sorted, arrivals)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].T < sorted[j].T })
+
+	for _, a := range sorted {
+		if a.T < 0 || a.T >= intervalLength {
+			continue
+		}
+		now = intervalStart.Add(time.Duration(a.T) * time.Second)
+		bucket := &res.Distribution[a.T*int64(conf.Buckets)/intervalLength]
+
+		selected, err := s.TryReserveSlot(a.ParticipantID, "")
+		if err != nil {
+			return res, fmt.Errorf("arrival at %d: %w", a.T, err)
+		}
+		res.Arrivals += 1
+		bucket.Arrivals += 1
+		if selected {
+			res.Selected += 1
+			bucket.Selected += 1
+		} else {
+			res.TurnedAway += 1
+		}
+	}
+
+	res.UsedSlots = s.GetSamplerInfos().UsedSlots
+	if res.Target > 0 {
+		res.FillRate = float64(res.UsedSlots) / float64(res.Target)
+	}
+	return res, nil
+}
+
+// SyntheticArrivals draws n arrivals of distinct participants in the simulated interval, distributed like the curve source or uniformly.
+// Only sources based on submission times (see TimeSampler) can be used for the distribution.
+func SyntheticArrivals(conf SimulationConfig, n int, uniform bool, seed int64) ([]Arrival, error) {
+	intervalStart := conf.Interval.IntervalStartAt(conf.IntervalStart)
+	length := conf.Interval.IntervalEnd(intervalStart).Unix() - intervalStart.Unix()
+
+	var times []int
+	if uniform {
+		r := rand.New(rand.NewSource(seed))
+		times = make([]int, n)
+		for i := range times {
+			times[i] = int(r.Int63n(length))
+		}
+	} else {
+		ts, ok := conf.Source.(TimeSampler)
+		if !ok {
+			return nil, errors.New("the curve source has no distribution of submission times, use uniform arrivals")
+		}
+		var err error
+		times, err = ts.SampleTimes(n, length, seed)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	arrivals := make([]Arrival, n)
+	for i, t := range times {
+		arrivals[i] = Arrival{T: int64(t), ParticipantID: fmt.Sprintf("participant-%d", i)}
+	}
+	return arrivals, nil
+}
@@ -0,0 +1,86 @@
+package sampler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimulate(t *testing.T) {
+	schedule, err := NewScheduleSource(UniformSchedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interval := DefaultIntervalConfig()
+	interval.Location = time.UTC
+	conf := SimulationConfig{
+		Interval:         interval,
+		IntervalStart:    time.Date(2025, time.March, 5, 12, 0, 0, 0, time.UTC),
+		Source:           schedule,
+		TargetSamples:    10,
+		OpenSlotsAtStart: 2,
+		Seed:             1,
+		Buckets:          7,
+	}
+
+	// 2 slots are open at the start, one more every 75600 seconds (1/8 of the week), the last one at the end of the week
+	arrivals := []Arrival{
+		{T: 604799, ParticipantID: "p7"}, // 10 open, 4 used
+		{T: 100, ParticipantID: "p1"},
+		{T: 200, ParticipantID: "p2"},
+		{T: 300, ParticipantID: "p3"},   // both open slots are used
+		{T: 75600, ParticipantID: "p4"}, // third slot opens
+		{T: 80000, ParticipantID: "p5"},
+		{T: 90000, ParticipantID: "p1"},  // already has a reservation, no new slot is used
+		{T: 500000, ParticipantID: "p6"}, // 8 open, 3 used
+		{T: -5, ParticipantID: "before"},
+		{T: 604800, ParticipantID: "after"},
+	}
+
+	res, err := Simulate(conf, arrivals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.IntervalStart != time.Date(2025, time.March, 3, 0, 0, 0, 0, time.UTC).Unix() || res.Target != 10 {
+		t.Errorf("unexpected interval start %d or target %d", res.IntervalStart, res.Target)
+	}
+	if res.Arrivals != 8 || res.Selected != 6 || res.TurnedAway != 2 {
+		t.Errorf("expected 8 arrivals, 6 selected and 2 turned away, got %d, %d and %d", res.Arrivals, res.Selected, res.TurnedAway)
+	}
+	if res.UsedSlots != 5 || res.FillRate != 0.5 {
+		t.Errorf("expected 5 used slots and a fill rate of 0.5, got %d and %f", res.UsedSlots, res.FillRate)
+	}
+
+	expected := []SimulationBucket{
+		{Start: 0, End: 86400, Arrivals: 5, Selected: 3},
+		{Start: 86400, End: 172800, Arrivals: 1, Selected: 1},
+		{Start: 172800, End: 259200},
+		{Start: 259200, End: 345600},
+		{Start: 345600, End: 432000},
+		{Start: 432000, End: 518400, Arrivals: 1, Selected: 1},
+		{Start: 518400, End: 604800, Arrivals: 1, Selected: 1},
+	}
+	if len(res.Distribution) != len(expected) {
+		t.Fatalf("expected %d buckets, got %d", len(expected), len(res.Distribution))
+	}
+	for i, b := range expected {
+		if res.Distribution[i] != b {
+			t.Errorf("bucket %d: expected %+v, got %+v", i, b, res.Distribution[i])
+		}
+	}
+}
+
+func TestSimulateRejectsInvalidConfig(t *testing.T) {
+	schedule, err := NewScheduleSource(UniformSchedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := SimulationConfig{Interval: DefaultIntervalConfig(), Source: schedule, TargetSamples: 10, Buckets: 0}
+	if _, err := Simulate(conf, nil); err == nil {
+		t.Error("expected an error without buckets")
+	}
+	conf.Buckets = 7
+	conf.OpenSlotsAtStart = 11
+	if _, err := Simulate(conf, nil); err == nil {
+		t.Error("expected an error with more slots open at the start than the target")
+	}
+}
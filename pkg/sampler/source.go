@@ -0,0 +1,429 @@
+package sampler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CurveSource provides the slot openings of new slot curves
+type CurveSource interface {
+	// Kind is stored as the source of the curves, e.g. "sampleFile"
+	Kind() string
+	// Name is the name of the file the curves are based on, empty if there is none
+	Name() string
+	// OpenSlots returns the slot openings of an interval of intervalLength seconds, with minVal slots open at the start and target slots at the end.
+	// Random sources draw with the seed, so the same inputs always result in the same openings.
+	OpenSlots(target int, minVal int, intervalLength int64, seed int64) ([]OpenSlots, error)
+}
+
+// TimeSampler is implemented by curve sources based on a distribution of submission times, e.g. to draw synthetic arrivals
+type TimeSampler interface {
+	// SampleTimes draws n random times as sorted seconds since the start of an interval of intervalLength seconds
+	SampleTimes(n int, intervalLength int64, seed int64) ([]int, error)
+}
+
+// Reloader is implemented by curve sources based on a file, so a corrected file can be used without a restart
+type Reloader interface {
+	// Reload reads and checks the file again and returns a new source with its content, the source itself is not changed
+	Reload() (CurveSource, error)
+}
+
+var ErrInvalidTarget = errors.New("target must be at least the open slots at start, which must not be negative")
+
+// slotsToOpen returns the number of slots opened after the interval start
+func slotsToOpen(target int, minVal int) (int, error) {
+	if minVal < 0 || target < minVal {
+		return 0, fmt.Errorf("%w: target %d, open slots at start %d", ErrInvalidTarget, target, minVal)
+	}
+	return target - minVal, nil
+}
+
+// WithCurveSource sets the source new slot curves are drawn from
+func WithCurveSource(source CurveSource) Option {
+	return func(s *Sampler) {
+		s.source = source
+	}
+}
+
+// Source returns the source new slot curves are drawn from, nil if none was set
+func (s *Sampler) Source() CurveSource {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.source
+}
+
+// ReloadSource reads the file of the curve source again and uses it for new curves. If the file can't be read or is invalid,
+// the source in use is kept and the error is returned. Returns false for sources without a file.
+func (s *Sampler) ReloadSource() (bool, error) {
+	r, ok := s.Source().(Reloader)
+	if !ok {
+		return false, nil
+	}
+	source, err := r.Reload()
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.source = source
+	return true, nil
+}
+
+// openSlotsFromTimes opens one slot at each time, on top of minVal slots open at the start
+func openSlotsFromTimes(times []int, minVal int) []OpenSlots {
+	openSlots := []OpenSlots{
+		{T: 0, Value: minVal},
+	}
+	for _, t := range times {
+		lastSlotOpening := openSlots[len(openSlots)-1]
+		if t == lastSlotOpening.T {
+			openSlots[len(openSlots)-1].Value += 1
+		} else {
+			openSlots = append(openSlots,
+				OpenSlots{T: t, Value: lastSlotOpening.Value + 1},
+			)
+		}
+	}
+	return openSlots
+}
+
+// SampleFileSource draws slot openings from the submission times of a typical interval
+type SampleFileSource struct {
+	filePath     string
+	values       []int // time column of the sample file, in units of timeUnit
+	timeUnit     time.Duration
+	sampleLength time.Duration
+}
+
+// NewSampleFileSource reads a CSV file with a header row and the submission times in the second column, as multiples of timeUnit
+// (e.g. minutes) since the start of an interval of sampleLength. Problems with the file are returned as *SampleFileError.
+func NewSampleFileSource(filePath string, timeUnit time.Duration, sampleLength time.Duration) (*SampleFileSource, error) {
+	if timeUnit <= 0 || sampleLength <= 0 {
+		return nil, errors.New("time unit and sample length must be positive")
+	}
+	rows, err := readSampleCSV(filePath, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]int, len(rows))
+	for i, row := range rows {
+		value, err := strconv.Atoi(strings.TrimSpace(row[1]))
+		if err != nil {
+			return nil, &SampleFileError{Path: filePath, Row: i + 2, Err: fmt.Errorf("%w: '%s' is not a whole number", ErrInvalidValue, row[1])}
+		}
+		// a sample at the very end of the sample length would open a slot after the interval
+		if value < 0 || time.Duration(value)*timeUnit >= sampleLength {
+			return nil, &SampleFileError{Path: filePath, Row: i + 2, Err: fmt.Errorf("%w: %d x %s is not within [0, %s)", ErrValueOutOfRange, value, timeUnit, sampleLength)}
+		}
+		values[i] = value
+	}
+	return &SampleFileSource{
+		filePath:     filePath,
+		values:       values,
+		timeUnit:     timeUnit,
+		sampleLength: sampleLength,
+	}, nil
+}
+
+func (src *SampleFileSource) Kind() string {
+	return SLOT_CURVE_SOURCE_SAMPLE_FILE
+}
+
+func (src *SampleFileSource) Name() string {
+	return filepath.Base(src.filePath)
+}
+
+func (src *SampleFileSource) Reload() (CurveSource, error) {
+	source, err := NewSampleFileSource(src.filePath, src.timeUnit, src.sampleLength)
+	if err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+func (src *SampleFileSource) OpenSlots(target int, minVal int, intervalLength int64, seed int64) ([]OpenSlots, error) {
+	n, err := slotsToOpen(target, minVal)
+	if err != nil {
+		return nil, err
+	}
+	times, err := src.SampleTimes(n, intervalLength, seed)
+	if err != nil {
+		return nil, err
+	}
+	return openSlotsFromTimes(times, minVal), nil
+}
+
+func (src *SampleFileSource) SampleTimes(n int, intervalLength int64, seed int64) ([]int, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("number of sample times must not be negative: %d", n)
+	}
+	r := rand.New(rand.NewSource(seed))
+	// sample times are stretched or compressed to the actual interval length (e.g. a month with 31 days)
+	scale := float64(intervalLength) / src.sampleLength.Seconds()
+
+	samples := make([]int, n)
+	for i := 0; i < n; i++ {
+		index := r.Intn(len(src.values))
+		samples[i] = int((time.Duration(src.values[index]) * src.timeUnit).Seconds() * scale)
+	}
+	sort.Ints(samples)
+	return samples, nil
+}
+
+// HistogramSource draws slot openings from the share of submissions per hour of a typical interval
+type HistogramSource struct {
+	filePath     string
+	cumulative   []float64 // cumulative share up to and including each hour
+	sampleLength time.Duration
+}
+
+// NewHistogramSource reads a CSV file with a header row, the hour since the start of an interval of sampleLength in the first column
+// and its share of the submissions in the second. Shares are relative weights, they don't need to add up to 1. Missing hours have no share.
+// Problems with the file are returned as *SampleFileError.
+func NewHistogramSource(filePath string, sampleLength time.Duration) (*HistogramSource, error) {
+	hours := int(math.Ceil(sampleLength.Hours()))
+	if hours < 1 {
+		return nil, errors.New("sample length must be positive")
+	}
+	rows, err := readSampleCSV(filePath, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	weights := make([]float64, hours)
+	for i, row := range rows {
+		hour, err := strconv.Atoi(strings.TrimSpace(row[0]))
+		if err != nil {
+			return nil, &SampleFileError{Path: filePath, Row: i + 2, Err: fmt.Errorf("%w: hour '%s' is not a whole number", ErrInvalidValue, row[0])}
+		}
+		if hour < 0 || hour >= hours {
+			return nil, &SampleFileError{Path: filePath, Row: i + 2, Err: fmt.Errorf("%w: hour %d is not within [0, %d)", ErrValueOutOfRange, hour, hours)}
+		}
+		share, err := strconv.ParseFloat(strings.TrimSpace(row[1]), 64)
+		if err != nil || share < 0 || math.IsInf(share, 0) || math.IsNaN(share) {
+			return nil, &SampleFileError{Path: filePath, Row: i + 2, Err: fmt.Errorf("%w: share '%s' must be a number not below 0", ErrInvalidValue, row[1])}
+		}
+		weights[hour] += share
+	}
+
+	cumulative := make([]float64, hours)
+	sum := 0.0
+	for i, w := range weights {
+		sum += w
+		cumulative[i] = sum
+	}
+	if sum <= 0 {
+		return nil, &SampleFileError{Path: filePath, Err: fmt.Errorf("%w: all shares are 0", ErrNoSamples)}
+	}
+	return &HistogramSource{
+		filePath:     filePath,
+		cumulative:   cumulative,
+		sampleLength: sampleLength,
+	}, nil
+}
+
+func (src *HistogramSource) Kind() string {
+	return SLOT_CURVE_SOURCE_HISTOGRAM
+}
+
+func (src *HistogramSource) Name() string {
+	return filepath.Base(src.filePath)
+}
+
+func (src *HistogramSource) Reload() (CurveSource, error) {
+	source, err := NewHistogramSource(src.filePath, src.sampleLength)
+	if err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+func (src *HistogramSource) OpenSlots(target int, minVal int, intervalLength int64, seed int64) ([]OpenSlots, error) {
+	n, err := slotsToOpen(target, minVal)
+	if err != nil {
+		return nil, err
+	}
+	times, err := src.SampleTimes(n, intervalLength, seed)
+	if err != nil {
+		return nil, err
+	}
+	return openSlotsFromTimes(times, minVal), nil
+}
+
+// SampleTimes draws an hour weighted by its share, and a uniformly distributed time within that hour
+func (src *HistogramSource) SampleTimes(n int, intervalLength int64, seed int64) ([]int, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("number of sample times must not be negative: %d", n)
+	}
+	r := rand.New(rand.NewSource(seed))
+	scale := float64(intervalLength) / src.sampleLength.Seconds()
+	total := src.cumulative[len(src.cumulative)-1]
+	sampleSeconds := src.sampleLength.Seconds()
+
+	samples := make([]int, n)
+	for i := 0; i < n; i++ {
+		x := r.Float64() * total
+		hour := sort.Search(len(src.cumulative), func(h int) bool { return src.cumulative[h] > x })
+		if hour >= len(src.cumulative) {
+			hour = len(src.cumulative) - 1
+		}
+		t := math.Min(float64(hour)*3600+r.Float64()*3600, sampleSeconds-1)
+		samples[i] = int(t * scale)
+	}
+	sort.Ints(samples)
+	return samples, nil
+}
+
+// SchedulePoint is a point of a piecewise-linear schedule: at share X of the interval, share Y of the slots are open
+type SchedulePoint struct {
+	X float64
+	Y float64
+}
+
+// ScheduleSource opens slots deterministically along a piecewise-linear schedule, e.g. uniformly over the interval
+type ScheduleSource struct {
+	points []SchedulePoint
+}
+
+// UniformSchedule opens the slots evenly spread over the interval
+var UniformSchedule = []SchedulePoint{{X: 0, Y: 0}, {X: 1, Y: 1}}
+
+// NewScheduleSource checks the schedule: it must start at X=0, end at X=1 with Y=1, X must increase and Y must not decrease
+func NewScheduleSource(points []SchedulePoint) (*ScheduleSource, error) {
+	if len(points) < 2 {
+		return nil, errors.New("schedule needs at least two points")
+	}
+	if points[0].X != 0 || points[len(points)-1].X != 1 || points[len(points)-1].Y != 1 {
+		return nil, errors.New("schedule must start at 0 and end at 1:1")
+	}
+	for i, p := range points {
+		if p.Y < 0 || p.Y > 1 {
+			return nil, fmt.Errorf("schedule point %d: share of slots must be between 0 and 1", i)
+		}
+		if i > 0 && p.X <= points[i-1].X {
+			return nil, fmt.Errorf("schedule point %d: share of the interval must be greater than the previous one", i)
+		}
+		if i > 0 && p.Y < points[i-1].Y {
+			return nil, fmt.Errorf("schedule point %d: share of slots must not be lower than the previous one", i)
+		}
+	}
+	return &ScheduleSource{points: points}, nil
+}
+
+// ParseSchedule parses a schedule written as comma separated X:Y pairs, e.g. "0:0,0.5:0.8,1:1"
+func ParseSchedule(v string) ([]SchedulePoint, error) {
+	points := []SchedulePoint{}
+	for _, part := range strings.Split(v, ",") {
+		xy := strings.Split(strings.TrimSpace(part), ":")
+		if len(xy) != 2 {
+			return nil, fmt.Errorf("wrong schedule point '%s', expected X:Y", part)
+		}
+		x, err := strconv.ParseFloat(xy[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("wrong schedule point '%s': %w", part, err)
+		}
+		y, err := strconv.ParseFloat(xy[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("wrong schedule point '%s': %w", part, err)
+		}
+		points = append(points, SchedulePoint{X: x, Y: y})
+	}
+	return points, nil
+}
+
+func (src *ScheduleSource) Kind() string {
+	return SLOT_CURVE_SOURCE_SCHEDULE
+}
+
+func (src *ScheduleSource) Name() string {
+	return ""
+}
+
+// OpenSlots opens the k-th of the scheduled slots at the first time the schedule reaches k/(target-minVal), the seed is not used
+func (src *ScheduleSource) OpenSlots(target int, minVal int, intervalLength int64, seed int64) ([]OpenSlots, error) {
+	n, err := slotsToOpen(target, minVal)
+	if err != nil {
+		return nil, err
+	}
+	times := make([]int, n)
+	for k := 1; k <= n; k++ {
+		x := src.shareOfIntervalAt(float64(k) / float64(n))
+		times[k-1] = int(math.Min(x*float64(intervalLength), float64(intervalLength-1)))
+	}
+	return openSlotsFromTimes(times, minVal), nil
+}
+
+// shareOfIntervalAt returns the first X at which the schedule reaches share y of the slots
+func (src *ScheduleSource) shareOfIntervalAt(y float64) float64 {
+	if y <= src.points[0].Y {
+		return 0
+	}
+	for i := 1; i < len(src.points); i++ {
+		a, b := src.points[i-1], src.points[i]
+		if b.Y < y {
+			continue
+		}
+		return a.X + (y-a.Y)/(b.Y-a.Y)*(b.X-a.X)
+	}
+	return 1
+}
+
+// JSONCurveSource uses the open slots of a JSON file verbatim for every interval, targets and seeds are ignored
+type JSONCurveSource struct {
+	filePath  string
+	openSlots []OpenSlots
+}
+
+// NewJSONCurveSource reads a file like the upload payload, e.g. { "openSlots": [{ "t": 0, "value": 5 }] } with t in seconds since the interval start
+func NewJSONCurveSource(filePath string) (*JSONCurveSource, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var curve struct {
+		OpenSlots []OpenSlots `json:"openSlots"`
+	}
+	if err := json.Unmarshal(content, &curve); err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	if err := ValidateOpenSlots(curve.OpenSlots, math.MaxInt64); err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return &JSONCurveSource{filePath: filePath, openSlots: curve.OpenSlots}, nil
+}
+
+func (src *JSONCurveSource) Kind() string {
+	return SLOT_CURVE_SOURCE_JSON_FILE
+}
+
+func (src *JSONCurveSource) Name() string {
+	return filepath.Base(src.filePath)
+}
+
+func (src *JSONCurveSource) Reload() (CurveSource, error) {
+	source, err := NewJSONCurveSource(src.filePath)
+	if err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+func (src *JSONCurveSource) OpenSlots(target int, minVal int, intervalLength int64, seed int64) ([]OpenSlots, error) {
+	if err := ValidateOpenSlots(src.openSlots, intervalLength); err != nil {
+		return nil, fmt.Errorf("%s: %w", src.Name(), err)
+	}
+	openSlots := make([]OpenSlots, len(src.openSlots))
+	copy(openSlots, src.openSlots)
+	return openSlots, nil
+}
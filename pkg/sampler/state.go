@@ -0,0 +1,123 @@
+package sampler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	SAMPLER_STATE_ACTIVE = "active"
+	SAMPLER_STATE_PAUSED = "paused"
+)
+
+var (
+	ErrSamplerPaused = errors.New("sampler is paused")
+	ErrBlackout      = errors.New("sampling is not possible during a blackout")
+)
+
+// SamplerState is set by an admin to stop sampling, e.g. during a lab closure. It is shared by all instances of the service.
+type SamplerState struct {
+	State     string `bson:"state" json:"state"`
+	Reason    string `bson:"reason,omitempty" json:"reason,omitempty"`
+	ChangedAt int64  `bson:"changedAt,omitempty" json:"changedAt,omitempty"`
+}
+
+// Blackout is a time range [Start, End) in which no participant is selected, e.g. a public holiday
+type Blackout struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// WithBlackouts sets the time ranges in which no participant is selected
+func WithBlackouts(blackouts []Blackout) Option {
+	return func(s *Sampler) {
+		s.blackouts = blackouts
+	}
+}
+
+// ParseBlackouts parses comma separated date ranges like "2025-12-24/2026-01-01" (both days included) or single days like "2026-04-27".
+// Days start at midnight in loc.
+func ParseBlackouts(v string, loc *time.Location) ([]Blackout, error) {
+	blackouts := []Blackout{}
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		startDay, endDay, found := strings.Cut(part, "/")
+		if !found {
+			endDay = startDay
+		}
+		start, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(startDay), loc)
+		if err != nil {
+			return nil, fmt.Errorf("blackout '%s': %w", part, err)
+		}
+		end, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(endDay), loc)
+		if err != nil {
+			return nil, fmt.Errorf("blackout '%s': %w", part, err)
+		}
+		if end.Before(start) {
+			return nil, fmt.Errorf("blackout '%s': end is before start", part)
+		}
+		blackouts = append(blackouts, Blackout{Start: start.Unix(), End: end.AddDate(0, 0, 1).Unix()})
+	}
+	return blackouts, nil
+}
+
+// NextBlackout returns the blackout in progress at t, or the next one to start after t, nil if there is none
+func (s *Sampler) NextBlackout(t time.Time) *Blackout {
+	var next *Blackout
+	for i, b := range s.blackouts {
+		if b.End <= t.Unix() {
+			continue
+		}
+		if next == nil || b.Start < next.Start {
+			next = &s.blackouts[i]
+		}
+	}
+	return next
+}
+
+// CheckActive returns ErrSamplerPaused or ErrBlackout if no participant can be selected now
+func (s *Sampler) CheckActive() error {
+	now := s.now()
+	if b := s.NextBlackout(now); b != nil && b.Start <= now.Unix() {
+		return fmt.Errorf("%w until %s", ErrBlackout, time.Unix(b.End, 0).In(s.interval.Location).Format(time.RFC3339))
+	}
+
+	state, err := s.State()
+	if err != nil {
+		return err
+	}
+	if state.State == SAMPLER_STATE_PAUSED {
+		return ErrSamplerPaused
+	}
+	return nil
+}
+
+// State returns the state set by an admin, active if it was never set
+func (s *Sampler) State() (SamplerState, error) {
+	state, err := s.dbService.LoadSamplerState(s.instanceID)
+	if err != nil {
+		return state, err
+	}
+	if state.State == "" {
+		state.State = SAMPLER_STATE_ACTIVE
+	}
+	return state, nil
+}
+
+// SetState pauses or resumes sampling on all instances
+func (s *Sampler) SetState(state string, reason string) (SamplerState, error) {
+	if state != SAMPLER_STATE_ACTIVE && state != SAMPLER_STATE_PAUSED {
+		return SamplerState{}, fmt.Errorf("unknown sampler state '%s', expected active or paused", state)
+	}
+	newState := SamplerState{
+		State:     state,
+		Reason:    reason,
+		ChangedAt: s.now().Unix(),
+	}
+	return newState, s.dbService.SaveSamplerState(s.instanceID, newState)
+}
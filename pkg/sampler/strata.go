@@ -0,0 +1,167 @@
+package sampler
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+var ErrUnknownStratum = errors.New("stratum has no quota in the slot curve")
+
+// StratumConfig defines the sample quota of one stratum, e.g. an age group in a region
+type StratumConfig struct {
+	Key              string `json:"key"`
+	TargetSamples    int    `json:"targetSamples"`
+	OpenSlotsAtStart int    `json:"openSlotsAtStart"`
+}
+
+// StratumCurve is the slot curve of one stratum, slots of a stratum can only be used by its participants
+type StratumCurve struct {
+	Key              string      `bson:"key" json:"key"`
+	OpenSlots        []OpenSlots `bson:"openSlots" json:"openSlots"`
+	TargetSamples    int         `bson:"targetSamples,omitempty" json:"targetSamples,omitempty"`
+	OpenSlotsAtStart int         `bson:"openSlotsAtStart,omitempty" json:"openSlotsAtStart,omitempty"`
+	CarriedOver      int         `bson:"carriedOver,omitempty" json:"carriedOver,omitempty"`
+}
+
+// WithStrata makes the sampler draw a separate slot curve for each stratum
+func WithStrata(strata []StratumConfig) Option {
+	return func(s *Sampler) {
+		s.strata = strata
+	}
+}
+
+// Stratified is true if new slot curves are drawn per stratum
+func (s *Sampler) Stratified() bool {
+	return len(s.strata) > 0
+}
+
+// Stratum returns the curve of the stratum with the given key
+func (c SlotCurve) Stratum(key string) (StratumCurve, bool) {
+	for _, st := range c.Strata {
+		if st.Key == key {
+			return st, true
+		}
+	}
+	return StratumCurve{}, false
+}
+
+// DrawSlotCurve draws the slot curve of the interval starting at intervalStart, per stratum if strata are configured.
+// target and minVal are only used without strata. carried holds the slots carried over from the previous interval by stratum key (see CarryOverTo),
+// they are drawn from the sample file in addition to the target.
+func (s *Sampler) DrawSlotCurve(target int, minVal int, intervalStart time.Time, seed int64, carried map[string]int) (SlotCurve, error) {
+	if s.Source() == nil {
+		return SlotCurve{}, errors.New("no curve source configured")
+	}
+	source, observedArrivals := s.curveSourceFor(intervalStart)
+
+	if !s.Stratified() {
+		curve, err := s.newSlotCurveFromSource(source, target+carried[""], minVal, intervalStart, seed)
+		if err != nil {
+			return curve, err
+		}
+		curve.CarriedOver = appliedCarryOver(curve, target+carried[""], carried[""])
+		curve.setAdaptive(observedArrivals, s.adaptive.Weight)
+		return curve, nil
+	}
+
+	// each stratum gets its own seed derived from the curve's seed, so the whole curve can be reproduced
+	seeds := rand.New(rand.NewSource(seed))
+	strata := make([]StratumCurve, len(s.strata))
+	carriedOver := 0
+	for i, conf := range s.strata {
+		target := conf.TargetSamples + carried[conf.Key]
+		c, err := s.newSlotCurveFromSource(source, target, conf.OpenSlotsAtStart, intervalStart, seeds.Int63())
+		if err != nil {
+			return SlotCurve{}, fmt.Errorf("stratum '%s': %w", conf.Key, err)
+		}
+		strata[i] = StratumCurve{
+			Key:              conf.Key,
+			OpenSlots:        c.OpenSlots,
+			TargetSamples:    c.TargetSamples,
+			OpenSlotsAtStart: conf.OpenSlotsAtStart,
+			CarriedOver:      appliedCarryOver(c, target, carried[conf.Key]),
+		}
+		carriedOver += strata[i].CarriedOver
+	}
+
+	curve := SlotCurve{
+		IntervalStart: intervalStart.Unix(),
+		IntervalEnd:   s.interval.IntervalEnd(intervalStart).Unix(),
+		OpenSlots:     mergeOpenSlots(strata),
+		Strata:        strata,
+		Release:       s.release,
+		Source:        source.Kind(),
+		SampleFile:    source.Name(),
+		Seed:          &seed,
+		CarriedOver:   carriedOver,
+	}
+	curve.TargetSamples = curve.MaxTarget()
+	curve.OpenSlotsAtStart = curve.OpenSlots[0].Value
+	curve.setAdaptive(observedArrivals, s.adaptive.Weight)
+	return curve, nil
+}
+
+// NewStratifiedSlotCurve checks hand-crafted curves per stratum and wraps them into a slot curve for the interval starting at intervalStart
+func (s *Sampler) NewStratifiedSlotCurve(strata []StratumCurve, intervalStart time.Time) (SlotCurve, error) {
+	intervalEnd := s.interval.IntervalEnd(intervalStart)
+	keys := map[string]bool{}
+	for _, st := range strata {
+		if st.Key == "" {
+			return SlotCurve{}, errors.New("stratum key must not be empty")
+		}
+		if keys[st.Key] {
+			return SlotCurve{}, fmt.Errorf("stratum '%s' is defined twice", st.Key)
+		}
+		keys[st.Key] = true
+		if err := ValidateOpenSlots(st.OpenSlots, intervalEnd.Unix()-intervalStart.Unix()); err != nil {
+			return SlotCurve{}, fmt.Errorf("stratum '%s': %w", st.Key, err)
+		}
+	}
+
+	curve, err := s.NewSlotCurve(mergeOpenSlots(strata), intervalStart)
+	if err != nil {
+		return curve, err
+	}
+	curve.Strata = strata
+	return curve, nil
+}
+
+// stratumCurve returns the curve of a single stratum, with the interval and release mode of the total curve
+func (c SlotCurve) stratumCurve(st StratumCurve) SlotCurve {
+	return SlotCurve{
+		IntervalStart: c.IntervalStart,
+		IntervalEnd:   c.IntervalEnd,
+		OpenSlots:     st.OpenSlots,
+		Release:       c.Release,
+	}
+}
+
+// mergeOpenSlots sums the step functions of all strata into one curve
+func mergeOpenSlots(strata []StratumCurve) []OpenSlots {
+	times := []int{0}
+	for _, st := range strata {
+		for _, o := range st.OpenSlots {
+			times = append(times, o.T)
+		}
+	}
+	sort.Ints(times)
+
+	merged := []OpenSlots{}
+	for i, t := range times {
+		if i > 0 && t == times[i-1] {
+			continue
+		}
+		value := 0
+		for _, st := range strata {
+			value += SlotCurve{OpenSlots: st.OpenSlots}.TargetAt(int64(t))
+		}
+		if len(merged) > 0 && merged[len(merged)-1].Value == value {
+			continue
+		}
+		merged = append(merged, OpenSlots{T: t, Value: value})
+	}
+	return merged
+}
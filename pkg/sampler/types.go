@@ -1,13 +1,27 @@
 package sampler
 
 import (
+	"sync"
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Sampler struct {
-	instanceID string
-	dbService  SamplerDBService
-	SlotCurve  SlotCurve
+	instanceID  string
+	dbService   SamplerDBService
+	interval    IntervalConfig
+	now         func() time.Time
+	newSeed     func() int64
+	strata      []StratumConfig
+	eligibility EligibilityRules
+	carryOver   CarryOverPolicy
+	source      CurveSource
+	adaptive    AdaptiveConfig
+	blackouts   []Blackout
+	release     string
+	mu          sync.RWMutex
+	slotCurve   SlotCurve
 }
 
 type OpenSlots struct {
@@ -18,13 +32,58 @@ type OpenSlots struct {
 type SlotCurve struct {
 	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 	IntervalStart int64              `bson:"intervalStart,omitempty" json:"intervalStart,omitempty"`
+	IntervalEnd   int64              `bson:"intervalEnd,omitempty" json:"intervalEnd,omitempty"`
 	OpenSlots     []OpenSlots        `bson:"openSlots,omitempty" json:"openSlots,omitempty"`
+	// with strata, OpenSlots is the sum of all strata and each participant can only use the slots of their stratum
+	Strata []StratumCurve `bson:"strata,omitempty" json:"strata,omitempty"`
+	// how slots open between the points of OpenSlots (and of the strata), step if empty
+	Release string `bson:"release,omitempty" json:"release,omitempty"`
+
+	// every change of an interval's curve is stored as a new version, the highest version is in use
+	Version          int    `bson:"version" json:"version"`
+	CreatedAt        int64  `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
+	Source           string `bson:"source,omitempty" json:"source,omitempty"`
+	TargetSamples    int    `bson:"targetSamples,omitempty" json:"targetSamples,omitempty"`
+	OpenSlotsAtStart int    `bson:"openSlotsAtStart,omitempty" json:"openSlotsAtStart,omitempty"`
+	// unused slots of the previous interval added to this curve, already included in TargetSamples
+	CarriedOver int `bson:"carriedOver,omitempty" json:"carriedOver,omitempty"`
+
+	// inputs of curves drawn from a curve source, to reproduce the curve
+	SampleFile string `bson:"sampleFile,omitempty" json:"sampleFile,omitempty"`
+	Seed       *int64 `bson:"seed,omitempty" json:"seed,omitempty"`
+	// number of recorded arrivals of previous intervals blended into an adaptive curve, with the share of slots drawn from them
+	ObservedArrivals int     `bson:"observedArrivals,omitempty" json:"observedArrivals,omitempty"`
+	AdaptiveWeight   float64 `bson:"adaptiveWeight,omitempty" json:"adaptiveWeight,omitempty"`
 }
 
+// RecordedArrival is an /is-selected call, used to adapt slot curves to the actual arrival pattern
+type RecordedArrival struct {
+	Time      int64     `bson:"time"`
+	Selected  bool      `bson:"selected"`
+	ExpiresAt time.Time `bson:"expiresAt"` // deleted by the DB once no curve can use it anymore
+}
+
+const (
+	SLOT_CURVE_SOURCE_SAMPLE_FILE = "sampleFile" // drawn from the sample file
+	SLOT_CURVE_SOURCE_HISTOGRAM   = "histogram"  // drawn from the share of submissions per hour
+	SLOT_CURVE_SOURCE_SCHEDULE    = "schedule"   // opened along a configured schedule
+	SLOT_CURVE_SOURCE_JSON_FILE   = "jsonFile"   // copied from a JSON file
+	SLOT_CURVE_SOURCE_UPLOAD      = "upload"     // hand-crafted open slots uploaded by an admin
+	SLOT_CURVE_SOURCE_PREVIOUS    = "previous"   // the previous interval's curve, kept because no new curve could be drawn
+)
+
 type SamplerDBService interface {
-	LoadLatestSlotCurve(instanceID string) (res SlotCurve, err error)
-	SaveNewSlotCurve(instanceID string, res SlotCurve) (err error)
+	LoadLatestSlotCurve(instanceID string, intervalStart int64) (res SlotCurve, err error)
+	SaveNewSlotCurve(instanceID string, obj SlotCurve) (res SlotCurve, err error)
 	GetUsedSlotsCountSince(instanceID string, ref int64) (count int64, err error)
+	GetUsedSlotsCountPerStratumSince(instanceID string, ref int64) (counts map[string]int64, err error)
+	ReserveSlot(instanceID string, participantID string, intervalStart int64, stratum string, target int) (reserved bool, err error)
+	GetParticipantSlotStats(instanceID string, participantID string, seasonStart int64) (stats ParticipantSlotStats, err error)
+	GetConfirmedSlotsCountPerStratum(instanceID string, from int64, until int64) (counts map[string]int64, err error)
+	SaveArrival(instanceID string, arrival RecordedArrival) error
+	FindArrivalTimes(instanceID string, from int64, until int64) (times []int64, err error)
+	LoadSamplerState(instanceID string) (state SamplerState, err error)
+	SaveSamplerState(instanceID string, state SamplerState) error
 }
 
 type SampleInfos struct {
@@ -33,4 +92,20 @@ type SampleInfos struct {
 	UsedSlots       int   `json:"usedSlots"`
 	AvailableSlots  int   `json:"availableSlots"`
 	MaxSlots        int   `json:"maxSlots"`
+	CurveVersion    int   `json:"curveVersion"`
+	// next times (seconds since the interval start) at which slots open, with the open slots target from then on
+	NextOpenings []OpenSlots `json:"nextOpenings,omitempty"`
+
+	State        string    `json:"state"`
+	NextBlackout *Blackout `json:"nextBlackout,omitempty"` // blackout in progress or the next one
+
+	Strata []StratumInfos `json:"strata,omitempty"`
+}
+
+type StratumInfos struct {
+	Key             string `json:"key"`
+	OpenSlotsTarget int    `json:"openSlotsTarget"`
+	UsedSlots       int    `json:"usedSlots"`
+	AvailableSlots  int    `json:"availableSlots"`
+	MaxSlots        int    `json:"maxSlots"`
 }
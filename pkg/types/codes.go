@@ -2,14 +2,85 @@ package types
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
+const (
+	ENTRY_CODE_STATUS_AVAILABLE = "available"
+	ENTRY_CODE_STATUS_USED      = "used"
+	ENTRY_CODE_STATUS_REVOKED   = "revoked"
+	ENTRY_CODE_STATUS_EXPIRED   = "expired"
+)
+
 type ValidationCode struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Code       string             `bson:"code,omitempty" json:"code,omitempty"`
-	UploadedAt int64              `bson:"uploadedAt" json:"uploadedAt"`
-	UsedAt     int64              `bson:"usedAt" json:"usedAt"`
-	UsedBy     string             `bson:"usedBy" json:"usedBy"`
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Code          string             `bson:"code,omitempty" json:"code,omitempty"`     // keyed hash of the code if Hashed is set
+	Hashed        bool               `bson:"hashed,omitempty" json:"hashed,omitempty"` // code was stored with entrycodes.Hasher
+	CodeBatchInfo `bson:",inline"`
+	Status        string `bson:"status,omitempty" json:"status,omitempty"`
+	UploadedAt    int64  `bson:"uploadedAt" json:"uploadedAt"`
+	UsedAt        int64  `bson:"usedAt" json:"usedAt"`
+	UsedBy        string `bson:"usedBy" json:"usedBy"`
+}
+
+// CodeBatchInfo is the metadata shared by all codes of a printed batch
+type CodeBatchInfo struct {
+	BatchID   string `bson:"batchID,omitempty" json:"batchID,omitempty"`
+	Label     string `bson:"label,omitempty" json:"label,omitempty"` // e.g. lot number
+	ExpiresAt int64  `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+}
+
+// EffectiveStatus derives the status at the given time, including expiry and codes stored before statuses were introduced
+func (vc ValidationCode) EffectiveStatus(now int64) string {
+	if vc.UsedAt > 0 {
+		return ENTRY_CODE_STATUS_USED
+	}
+	if vc.Status == ENTRY_CODE_STATUS_REVOKED || vc.Status == ENTRY_CODE_STATUS_EXPIRED {
+		return vc.Status
+	}
+	if vc.ExpiresAt > 0 && vc.ExpiresAt <= now {
+		return ENTRY_CODE_STATUS_EXPIRED
+	}
+	return ENTRY_CODE_STATUS_AVAILABLE
 }
 
 type NewCodeList struct {
 	Codes []string `json:"codes"`
+	CodeBatchInfo
+}
+
+const (
+	CODE_UPLOAD_RESULT_INSERTED       = "inserted" // in dry-run mode: would be inserted
+	CODE_UPLOAD_RESULT_DUPLICATE      = "duplicate"
+	CODE_UPLOAD_RESULT_INVALID_FORMAT = "invalid_format"
+	CODE_UPLOAD_RESULT_EMPTY          = "sanitized_to_empty"
+)
+
+type CodeUploadResult struct {
+	Code      string `json:"code"`                // code as uploaded
+	Sanitized string `json:"sanitized,omitempty"` // code as stored
+	Result    string `json:"result"`
+	Error     string `json:"error,omitempty"`
+}
+
+type CodeUploadReport struct {
+	DryRun     bool               `json:"dryRun"`
+	Total      int                `json:"total"`
+	Inserted   int                `json:"inserted"`
+	Duplicates int                `json:"duplicates"`
+	Invalid    int                `json:"invalid"`
+	Empty      int                `json:"empty"`
+	Results    []CodeUploadResult `json:"results"`
+}
+
+type GenerateCodesReq struct {
+	Count int `json:"count"`
+	CodeBatchInfo
+}
+
+// EntryCodeFilter narrows down the entry codes returned by admin queries, zero values are ignored
+type EntryCodeFilter struct {
+	Used          *bool  // nil: all codes, true: only used codes, false: only unused codes
+	UploadedFrom  int64  // unix timestamp, inclusive
+	UploadedUntil int64  // unix timestamp, inclusive
+	UsedBy        string // participantID
+	BatchID       string
+	Status        string // effective status, see ValidationCode.EffectiveStatus
 }
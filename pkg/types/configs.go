@@ -1,5 +1,12 @@
 package types
 
+import (
+	"time"
+
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/ratelimit"
+	"github.com/infectieradar-nl/self-swabbing-extension/pkg/sampler"
+)
+
 type DBConfig struct {
 	URI             string
 	DBNamePrefix    string
@@ -9,8 +16,65 @@ type DBConfig struct {
 }
 
 type SamplerConfig struct {
-	SampleFilePath      string
-	TargetSamples       int // maximum sample count target
-	OpenSlotsAtStart    int // number of slots open at start of the sample interval
+	CurveSource         sampler.CurveSource // source new slot curves are drawn from
+	SlotRelease         string              // how slots open between the points of new curves: step or linear
+	TargetSamples       int                 // maximum sample count target
+	OpenSlotsAtStart    int                 // number of slots open at start of the sample interval
 	MaxNrOfParticipants int64
+	Interval            sampler.IntervalConfig // length and alignment of the sampling intervals
+	Seed                *int64                 // fixed seed for drawing slot curves, random if nil
+	Strata              StrataConfig           // sample quotas per stratum, not stratified if empty
+	Eligibility         sampler.EligibilityRules
+	ReservationTTL      time.Duration // reservations without invite response expire after this time
+	ReservationCheck    time.Duration // how often expired reservations are looked for
+	CarryOver           sampler.CarryOverPolicy
+	Adaptive            sampler.AdaptiveConfig
+	Blackouts           []sampler.Blackout // time ranges in which no participant is selected
+}
+
+// StrataConfig defines how the stratum of a participant is derived and the quota of each stratum
+type StrataConfig struct {
+	// the stratum key is the values of all attributes joined by "|", e.g. "18-64|north"
+	Attributes []StratumAttribute      `json:"attributes"`
+	Strata     []sampler.StratumConfig `json:"strata"`
+	// stratum used for participants whose attribute values match no stratum, these are not selected if empty
+	DefaultStratum string `json:"defaultStratum"`
+}
+
+// StratumAttribute is read either from a participant flag or from a survey response of the /is-selected event
+type StratumAttribute struct {
+	Flag   string             `json:"flag"`
+	Survey *SurveyItemMapping `json:"survey"`
+}
+
+// SurveyItemMapping defines where a handler finds its input in a survey response
+type SurveyItemMapping struct {
+	ItemKey         string   // key of the survey item, e.g. "T1.CodeVal"
+	MatchMode       string   // how ItemKey is compared to the response item keys: "exact", "suffix" or "path"
+	ResponseSlot    string   // path of the response slot inside the item, e.g. "rg.cv.ic"
+	AcceptedOptions []string // option keys that count as a positive answer (if used by the handler)
+}
+
+// SurveyKeyMappings holds the survey item mapping for each external event handler
+type SurveyKeyMappings struct {
+	EntryCode      SurveyItemMapping
+	InviteResponse SurveyItemMapping
+}
+
+const (
+	RATE_LIMIT_BACKEND_MEMORY = "memory"
+	RATE_LIMIT_BACKEND_MONGO  = "mongo"
+)
+
+// CodeAttemptLimitConfig defines the brute-force protection of the entry code validation
+type CodeAttemptLimitConfig struct {
+	Backend string           // where failed attempts are tracked: "memory" or "mongo"
+	UID     ratelimit.Config // limits per participant
+	IP      ratelimit.Config // limits per client IP, disabled if MaxFailures is 0
+}
+
+// CodeCheckResponseConfig defines the uniform response timing of the entry code validation
+type CodeCheckResponseConfig struct {
+	ResponseTime  time.Duration // every response is written this long after the request arrived
+	MaxConcurrent int           // further requests are rejected with 429 while this many are waiting
 }
@@ -0,0 +1,26 @@
+package types
+
+import "github.com/infectieradar-nl/self-swabbing-extension/pkg/sampler"
+
+// UploadSlotCurveReq replaces the slot curve of an interval with hand-crafted open slots
+type UploadSlotCurveReq struct {
+	IntervalStart int64               `json:"intervalStart"` // any unix timestamp inside the interval, current interval if empty
+	OpenSlots     []sampler.OpenSlots `json:"openSlots"`
+	// curves per stratum instead of openSlots, the total curve is their sum
+	Strata []sampler.StratumCurve `json:"strata"`
+}
+
+// RegenerateSlotCurveReq draws a new slot curve for an interval from the sample file, empty fields use the configured values.
+// With strata, the targets of the strata config are used.
+type RegenerateSlotCurveReq struct {
+	IntervalStart    int64  `json:"intervalStart"`
+	TargetSamples    *int   `json:"targetSamples"`
+	OpenSlotsAtStart *int   `json:"openSlotsAtStart"`
+	Seed             *int64 `json:"seed"` // e.g. the seed of an earlier version, to reproduce that curve
+}
+
+// SetSamplerStateReq pauses or resumes sampling
+type SetSamplerStateReq struct {
+	State  string `json:"state" binding:"required"` // "active" or "paused"
+	Reason string `json:"reason"`                   // optional note, e.g. "lab closed"
+}
@@ -2,19 +2,99 @@ package utils
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/case-framework/case-backend/pkg/study/types"
 	"github.com/coneno/logger"
 )
 
-func FindSurveyItemResponse(response []types.SurveyItemResponse, itemKey string) (types.SurveyItemResponse, error) {
+// ItemMatchMode defines how the requested item key is compared to the keys of the survey item responses
+type ItemMatchMode string
+
+const (
+	ItemMatchExactKey ItemMatchMode = "exact"  // last segment of the item key equals the requested key, which must not contain "."
+	ItemMatchSuffix   ItemMatchMode = "suffix" // item key equals the requested key or ends with "." + requested key
+	ItemMatchFullPath ItemMatchMode = "path"   // item key equals the requested key
+)
+
+var ErrSurveyItemNotFound = errors.New("could not find response item")
+
+// AmbiguousItemMatchError is returned if more than one survey item matches the requested key
+type AmbiguousItemMatchError struct {
+	ItemKey string
+	Matches []string
+}
+
+func (e *AmbiguousItemMatchError) Error() string {
+	return fmt.Sprintf("ambiguous survey item key '%s', matching items: %s", e.ItemKey, strings.Join(e.Matches, ", "))
+}
+
+func IsValidItemMatchMode(mode ItemMatchMode) bool {
+	switch mode {
+	case ItemMatchExactKey, ItemMatchSuffix, ItemMatchFullPath:
+		return true
+	default:
+		return false
+	}
+}
+
+// ValidateItemKeyForMode checks that itemKey can match any item in the mode: the exact mode only compares the last segment of the item keys
+func ValidateItemKeyForMode(itemKey string, mode ItemMatchMode) error {
+	if mode == ItemMatchExactKey && strings.Contains(itemKey, ".") {
+		return fmt.Errorf("item key '%s' contains '.', which never matches in the exact mode, use the suffix or path mode", itemKey)
+	}
+	return nil
+}
+
+// FindSurveyItemResponse returns the single survey item response (including items nested in groups) matching itemKey
+func FindSurveyItemResponse(response []types.SurveyItemResponse, itemKey string, mode ItemMatchMode) (types.SurveyItemResponse, error) {
+	if !IsValidItemMatchMode(mode) {
+		return types.SurveyItemResponse{}, fmt.Errorf("unknown item match mode: %s", mode)
+	}
+	if err := ValidateItemKeyForMode(itemKey, mode); err != nil {
+		return types.SurveyItemResponse{}, err
+	}
+
+	matches := findMatchingSurveyItems(response, itemKey, mode)
+	switch len(matches) {
+	case 0:
+		return types.SurveyItemResponse{}, fmt.Errorf("%w: %s", ErrSurveyItemNotFound, itemKey)
+	case 1:
+		return matches[0], nil
+	default:
+		keys := make([]string, len(matches))
+		for i, m := range matches {
+			keys[i] = m.Key
+		}
+		return types.SurveyItemResponse{}, &AmbiguousItemMatchError{ItemKey: itemKey, Matches: keys}
+	}
+}
+
+func findMatchingSurveyItems(response []types.SurveyItemResponse, itemKey string, mode ItemMatchMode) []types.SurveyItemResponse {
+	matches := []types.SurveyItemResponse{}
 	for _, resp := range response {
-		if strings.Contains(resp.Key, itemKey) {
-			return resp, nil
+		if itemKeyMatches(resp.Key, itemKey, mode) {
+			matches = append(matches, resp)
+		}
+		if len(resp.Items) > 0 {
+			matches = append(matches, findMatchingSurveyItems(resp.Items, itemKey, mode)...)
 		}
 	}
-	return types.SurveyItemResponse{}, errors.New("Could not find response item")
+	return matches
+}
+
+func itemKeyMatches(key string, itemKey string, mode ItemMatchMode) bool {
+	switch mode {
+	case ItemMatchExactKey:
+		keyParts := strings.Split(key, ".")
+		return keyParts[len(keyParts)-1] == itemKey
+	case ItemMatchSuffix:
+		return key == itemKey || strings.HasSuffix(key, "."+itemKey)
+	case ItemMatchFullPath:
+		return key == itemKey
+	}
+	return false
 }
 
 func FindResponseSlot(rootItem *types.ResponseItem, slotKey string) (*types.ResponseItem, error) {
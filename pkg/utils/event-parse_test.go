@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/case-framework/case-backend/pkg/study/types"
+)
+
+func testSurveyResponse() []types.SurveyItemResponse {
+	return []types.SurveyItemResponse{
+		{Key: "weekly.T1", Items: []types.SurveyItemResponse{
+			{Key: "weekly.T1.CodeVal"},
+			{Key: "weekly.T1.CodeValHint"},
+		}},
+		{Key: "weekly.SwabSample", Items: []types.SurveyItemResponse{
+			{Key: "weekly.SwabSample.Confirm"},
+		}},
+		{Key: "weekly.Other", Items: []types.SurveyItemResponse{
+			{Key: "weekly.Other.Confirm"},
+		}},
+	}
+}
+
+func TestFindSurveyItemResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		itemKey string
+		mode    ItemMatchMode
+		want    string
+		wantErr error
+	}{
+		{name: "exact last segment", itemKey: "CodeVal", mode: ItemMatchExactKey, want: "weekly.T1.CodeVal"},
+		{name: "exact doesn't match prefix", itemKey: "CodeValH", mode: ItemMatchExactKey, wantErr: ErrSurveyItemNotFound},
+		{name: "suffix single segment", itemKey: "CodeValHint", mode: ItemMatchSuffix, want: "weekly.T1.CodeValHint"},
+		{name: "suffix dotted key", itemKey: "SwabSample.Confirm", mode: ItemMatchSuffix, want: "weekly.SwabSample.Confirm"},
+		{name: "suffix only at segment border", itemKey: "Sample.Confirm", mode: ItemMatchSuffix, wantErr: ErrSurveyItemNotFound},
+		{name: "path full key", itemKey: "weekly.SwabSample.Confirm", mode: ItemMatchFullPath, want: "weekly.SwabSample.Confirm"},
+		{name: "path partial key", itemKey: "SwabSample.Confirm", mode: ItemMatchFullPath, wantErr: ErrSurveyItemNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FindSurveyItemResponse(testSurveyResponse(), tt.itemKey, tt.mode)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Key != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got.Key)
+			}
+		})
+	}
+}
+
+func TestFindSurveyItemResponseAmbiguous(t *testing.T) {
+	for _, mode := range []ItemMatchMode{ItemMatchExactKey, ItemMatchSuffix} {
+		_, err := FindSurveyItemResponse(testSurveyResponse(), "Confirm", mode)
+		var ambiguous *AmbiguousItemMatchError
+		if !errors.As(err, &ambiguous) {
+			t.Fatalf("%s: expected AmbiguousItemMatchError, got %v", mode, err)
+		}
+		if ambiguous.ItemKey != "Confirm" || len(ambiguous.Matches) != 2 ||
+			ambiguous.Matches[0] != "weekly.SwabSample.Confirm" || ambiguous.Matches[1] != "weekly.Other.Confirm" {
+			t.Errorf("%s: unexpected error %+v", mode, ambiguous)
+		}
+	}
+}
+
+func TestFindSurveyItemResponseInvalidKeyOrMode(t *testing.T) {
+	if _, err := FindSurveyItemResponse(testSurveyResponse(), "SwabSample.Confirm", ItemMatchExactKey); err == nil || errors.Is(err, ErrSurveyItemNotFound) {
+		t.Errorf("expected dotted key to be rejected in the exact mode, got %v", err)
+	}
+	if _, err := FindSurveyItemResponse(testSurveyResponse(), "CodeVal", "prefix"); err == nil {
+		t.Error("expected unknown mode to be rejected")
+	}
+}